@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -253,6 +254,47 @@ func NewIdentExpr(name string) *Expr {
 	}
 }
 
+var invalidIdentRegexp = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Names generates identifiers that are unique among the names it generated
+// and the names reserved in it.
+type Names map[string]struct{}
+
+// NewNames returns a Names that never generates one of the reserved names.
+func NewNames(reserved ...[]string) Names {
+	n := make(Names)
+	for _, names := range reserved {
+		n.Reserve(names...)
+	}
+	return n
+}
+
+// Reserve prevents names from being generated.
+func (n Names) Reserve(names ...string) {
+	for _, name := range names {
+		n[name] = struct{}{}
+	}
+}
+
+// Unique returns a valid identifier made from name that isn't reserved or
+// already generated, and reserves it.
+func (n Names) Unique(name string) string {
+	name = invalidIdentRegexp.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = fmt.Sprintf("_%s", name)
+	}
+
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := n[unique]; !ok {
+			break
+		}
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	n.Reserve(unique)
+	return unique
+}
+
 // BasicLit represents a literal of basic type.
 type BasicLit struct {
 	Pos     lexer.Position
@@ -324,6 +366,14 @@ func NewStringExpr(v string) *Expr {
 	}
 }
 
+func NewStringExprs(vs ...string) []*Expr {
+	var exprs []*Expr
+	for _, v := range vs {
+		exprs = append(exprs, NewStringExpr(v))
+	}
+	return exprs
+}
+
 func NewDecimalExpr(v int) *Expr {
 	return &Expr{
 		BasicLit: &BasicLit{
@@ -590,6 +640,25 @@ type Comment struct {
 func (c *Comment) Position() lexer.Position { return c.Pos }
 func (c *Comment) End() lexer.Position      { return shiftPosition(c.Pos, len(c.Text)-1, 0) }
 
+// NewCommentGroup returns a comment group with a comment for every line of
+// texts.
+func NewCommentGroup(texts ...string) *CommentGroup {
+	group := &CommentGroup{}
+	for _, text := range texts {
+		for _, line := range strings.Split(text, "\n") {
+			group.List = append(group.List, &Comment{
+				Text: strings.TrimRight(fmt.Sprintf("# %s", line), " ") + "\n",
+			})
+		}
+	}
+	return group
+}
+
+// NewCommentStmt returns a statement that is only a comment.
+func NewCommentStmt(texts ...string) *Stmt {
+	return &Stmt{Doc: NewCommentGroup(texts...)}
+}
+
 type Newline struct {
 	Pos  lexer.Position
 	Text string `@Newline`
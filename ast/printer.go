@@ -0,0 +1,361 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Format returns the canonical source of a node.
+//
+// Unlike String, which unparses a node close to how it was written, Format
+// normalizes the layout. Indentation is always one tab per block, runs of blank
+// lines are collapsed into one, blank lines at the start and end of blocks are
+// removed, and declarations are separated by a blank line. Comments are kept
+// where they were written, either on a line of their own or trailing a
+// statement. A block is kept on a single line only if it was written on a
+// single line and every block nested inside it was too.
+//
+// Formatting is idempotent, so formatting the output of Format again returns
+// the same source.
+func Format(node Node) string {
+	p := &printer{}
+	p.print(node)
+	return p.buf.String()
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+}
+
+func (p *printer) print(node Node) {
+	switch n := node.(type) {
+	case *AST:
+		for i, file := range n.Files {
+			if i > 0 {
+				p.buf.WriteString("\n")
+			}
+			p.print(file)
+		}
+	case *File:
+		p.printFile(n)
+	case *Decl:
+		switch {
+		case n.Func != nil:
+			p.printFuncDecl(n.Func)
+		case n.Doc != nil:
+			p.printCommentGroup(n.Doc)
+		}
+	case *FuncDecl:
+		p.printFuncDecl(n)
+	case *Stmt:
+		switch {
+		case n.Call != nil:
+			p.printCallStmt(n.Call)
+		case n.Doc != nil:
+			p.printCommentGroup(n.Doc)
+		}
+	case *CallStmt:
+		p.printCallStmt(n)
+	case *BlockStmt:
+		p.printBlockStmt(n)
+	case *Expr:
+		p.printExpr(n)
+	case *CommentGroup:
+		p.printCommentGroup(n)
+	default:
+		p.buf.WriteString(node.String())
+	}
+}
+
+// item is an element of a declaration or statement list, which are laid out
+// the same way.
+type item struct {
+	// newline is set if the item is a newline token.
+	newline bool
+
+	// comments is set if the item is a comment group.
+	comments *CommentGroup
+
+	// content prints the declaration or call statement of the item.
+	content func()
+
+	// trailing is the comment ending a call statement.
+	trailing *Comment
+
+	// endsLine is set if the content consumes the end of its line.
+	endsLine bool
+}
+
+func (p *printer) printFile(f *File) {
+	var items []item
+	for _, decl := range f.Decls {
+		decl := decl
+		switch {
+		case decl.Func != nil:
+			items = append(items, item{
+				content: func() { p.printFuncDecl(decl.Func) },
+			})
+		case decl.Newline != nil:
+			items = append(items, item{newline: true})
+		case decl.Doc != nil:
+			items = append(items, item{comments: decl.Doc})
+		}
+	}
+
+	if p.printItems(items, true, false) {
+		p.buf.WriteString("\n")
+	}
+}
+
+// printItems lays out a list of items and returns whether the last line is
+// still open. Content is always started on a new line, and separated by a blank
+// line if separate is set. Otherwise, blank lines are only kept between items
+// that had blank lines between them.
+func (p *printer) printItems(items []item, separate, lineOpen bool) bool {
+	var (
+		// The source begins a file at the start of a line, but a block
+		// after its opening brace.
+		atLineStart = !lineOpen
+		blank       bool
+		started     bool
+		lastContent bool
+	)
+
+	for _, it := range items {
+		switch {
+		case it.newline:
+			if atLineStart {
+				blank = true
+			}
+			atLineStart = true
+		case it.comments != nil:
+			comments := it.comments.List
+			if len(comments) == 0 {
+				continue
+			}
+
+			if !atLineStart {
+				// The first comment trails the previous item on the same line.
+				p.buf.WriteString(" ")
+				p.printComment(comments[0])
+				p.buf.WriteString("\n")
+				comments = comments[1:]
+			} else {
+				if lineOpen {
+					p.buf.WriteString("\n")
+				}
+				if started && blank {
+					p.buf.WriteString("\n")
+				}
+			}
+
+			for _, comment := range comments {
+				p.writeIndent()
+				p.printComment(comment)
+				p.buf.WriteString("\n")
+			}
+
+			atLineStart = true
+			blank = false
+			started = true
+			lineOpen = false
+			lastContent = false
+		case it.content != nil:
+			if lineOpen {
+				p.buf.WriteString("\n")
+			}
+			if started && (blank || (separate && lastContent)) {
+				p.buf.WriteString("\n")
+			}
+
+			p.writeIndent()
+			it.content()
+
+			if it.trailing != nil {
+				p.buf.WriteString(" ")
+				p.printComment(it.trailing)
+				p.buf.WriteString("\n")
+				lineOpen = false
+			} else {
+				lineOpen = true
+			}
+
+			atLineStart = it.endsLine
+			blank = false
+			started = true
+			lastContent = true
+		}
+	}
+
+	return lineOpen
+}
+
+func (p *printer) writeIndent() {
+	p.buf.WriteString(strings.Repeat("\t", p.indent))
+}
+
+func (p *printer) printFuncDecl(fun *FuncDecl) {
+	fmt.Fprintf(&p.buf, "%s", fun.Type)
+	if fun.Method != nil {
+		fmt.Fprintf(&p.buf, " %s", fun.Method)
+	}
+
+	fmt.Fprintf(&p.buf, " %s", fun.Name)
+	if fun.Params != nil {
+		var fields []string
+		for _, field := range fun.Params.List {
+			fields = append(fields, field.String())
+		}
+		fmt.Fprintf(&p.buf, "(%s)", strings.Join(fields, ", "))
+	} else {
+		p.buf.WriteString("()")
+	}
+
+	if fun.Body != nil {
+		p.buf.WriteString(" ")
+		p.printBlockStmt(fun.Body)
+	}
+}
+
+func (p *printer) printCallStmt(call *CallStmt) {
+	p.buf.WriteString(call.Func.String())
+
+	for _, arg := range call.Args {
+		p.buf.WriteString(" ")
+		p.printExpr(arg)
+	}
+
+	// Empty option blocks are dropped, but blocks with only comments are kept
+	// so that formatting never deletes a comment.
+	with := call.WithOpt
+	if with != nil && (with.Ident != nil || (with.BlockLit != nil && !isEmpty(with.BlockLit.Body))) {
+		fmt.Fprintf(&p.buf, " %s ", with.With)
+		switch {
+		case with.Ident != nil:
+			p.buf.WriteString(with.Ident.String())
+		case with.BlockLit != nil:
+			p.printBlockLit(with.BlockLit)
+		}
+	}
+
+	if call.Alias != nil {
+		fmt.Fprintf(&p.buf, " %s", call.Alias)
+	}
+}
+
+func (p *printer) printExpr(expr *Expr) {
+	switch {
+	case expr.BlockLit != nil:
+		p.printBlockLit(expr.BlockLit)
+	default:
+		p.buf.WriteString(expr.String())
+	}
+}
+
+func (p *printer) printBlockLit(lit *BlockLit) {
+	fmt.Fprintf(&p.buf, "%s ", lit.Type)
+	p.printBlockStmt(lit.Body)
+}
+
+func (p *printer) printBlockStmt(block *BlockStmt) {
+	if isEmpty(block) {
+		p.buf.WriteString("{}")
+		return
+	}
+
+	if isInline(block) {
+		p.buf.WriteString("{ ")
+		for _, stmt := range block.List {
+			p.printCallStmt(stmt.Call)
+			p.buf.WriteString("; ")
+		}
+		p.buf.WriteString("}")
+		return
+	}
+
+	var items []item
+	for _, stmt := range block.List {
+		stmt := stmt
+		switch {
+		case stmt.Call != nil:
+			it := item{
+				content:  func() { p.printCallStmt(stmt.Call) },
+				endsLine: true,
+			}
+			if end := stmt.Call.StmtEnd; end != nil {
+				it.trailing = end.Comment
+				it.endsLine = end.Semicolon == nil
+			}
+			items = append(items, it)
+		case stmt.Newline != nil:
+			items = append(items, item{newline: true})
+		case stmt.Doc != nil:
+			items = append(items, item{comments: stmt.Doc})
+		}
+	}
+
+	p.buf.WriteString("{")
+	p.indent++
+	lineOpen := p.printItems(items, false, true)
+	p.indent--
+
+	if lineOpen {
+		p.buf.WriteString("\n")
+	}
+	p.writeIndent()
+	p.buf.WriteString("}")
+}
+
+func (p *printer) printCommentGroup(group *CommentGroup) {
+	for i, comment := range group.List {
+		if i > 0 {
+			p.buf.WriteString("\n")
+			p.writeIndent()
+		}
+		p.printComment(comment)
+	}
+}
+
+func (p *printer) printComment(comment *Comment) {
+	p.buf.WriteString(strings.TrimRight(comment.Text, " \t\r\n"))
+}
+
+// isEmpty returns whether a block has no call statements or comments.
+func isEmpty(block *BlockStmt) bool {
+	for _, stmt := range block.List {
+		if stmt.Call != nil || stmt.Doc.NumComments() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isInline returns whether a block and every block nested inside it was
+// written on a single line, which is when it has no newlines or comments and
+// every statement ends with a semicolon.
+func isInline(block *BlockStmt) bool {
+	for _, stmt := range block.List {
+		call := stmt.Call
+		if call == nil {
+			return false
+		}
+
+		if call.StmtEnd == nil || call.StmtEnd.Semicolon == nil {
+			return false
+		}
+
+		for _, arg := range call.Args {
+			if arg.BlockLit != nil && !isInline(arg.BlockLit.Body) {
+				return false
+			}
+		}
+
+		with := call.WithOpt
+		if with != nil && with.BlockLit != nil && with.BlockLit.NumStmts() > 0 && !isInline(with.BlockLit.Body) {
+			return false
+		}
+	}
+	return true
+}
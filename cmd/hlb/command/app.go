@@ -1,6 +1,7 @@
 package command
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 	_ "github.com/moby/buildkit/client/connhelper/kubepod"
 	"github.com/moby/buildkit/util/appdefaults"
 	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/report"
 	cli "github.com/urfave/cli/v2"
 )
 
@@ -29,17 +31,100 @@ func App() *cli.App {
 			Usage: "buildkitd address",
 			Value: defaultAddress,
 		},
+		&cli.StringFlag{
+			Name:  "diagnostics-format",
+			Usage: "format of errors written to stderr, one of text, json or sarif",
+			Value: "text",
+		},
+	}
+
+	app.Before = func(c *cli.Context) error {
+		format := c.String("diagnostics-format")
+		switch format {
+		case "text", "json", "sarif":
+		default:
+			return fmt.Errorf("unknown diagnostics format %q", format)
+		}
+		diagnosticsFormat = format
+		return nil
 	}
 
+	// Errors are returned to main instead of exiting, so that HandleError
+	// always writes the diagnostics document.
+	app.ExitErrHandler = func(c *cli.Context, err error) {}
+
 	app.Commands = []*cli.Command{
 		runCommand,
+		convertCommand,
+		decompileCommand,
 		formatCommand,
+		lintCommand,
 		getCommand,
+		lockCommand,
 		publishCommand,
+		debugCommand,
+		testCommand,
+		diffLLBCommand,
+		vendorCommand,
 	}
 	return app
 }
 
+// trustedKeysFlag is a file of public keys that frontends must be signed by
+// before they are used.
+var trustedKeysFlag = &cli.StringFlag{
+	Name:    "trusted-keys",
+	Usage:   "verify frontends are signed by one of the PEM encoded ECDSA public keys in a file",
+	EnvVars: []string{"HLB_TRUSTED_KEYS"},
+}
+
+// vendorDirFlag is the directory that remote sources are vendored to.
+var vendorDirFlag = &cli.StringFlag{
+	Name:  "vendor-dir",
+	Usage: "directory of remote sources vendored by hlb vendor",
+	Value: hlb.VendorDir,
+}
+
+// diagnosticsFormat is the format of errors written by HandleError, which is
+// set by the global diagnostics-format flag.
+var diagnosticsFormat = "text"
+
+// HandleError writes the error returned by running the app in the diagnostics
+// format and returns the exit code. Structured formats are written even when
+// there is no error, so that tools always have a document to read.
+func HandleError(w io.Writer, err error) int {
+	code := 0
+	if err != nil {
+		code = 1
+	}
+
+	// Commands that have already written their findings exit without a
+	// message, which is not a diagnostic.
+	if ec, ok := err.(cli.ExitCoder); ok {
+		code = ec.ExitCode()
+		if ec.Error() == "" {
+			err = nil
+		}
+	}
+
+	var werr error
+	switch diagnosticsFormat {
+	case "json":
+		werr = report.WriteDiagnosticsJSON(w, report.Diagnostics(err))
+	case "sarif":
+		werr = report.WriteDiagnosticsSARIF(w, report.Diagnostics(err))
+	default:
+		if err != nil {
+			fmt.Fprintf(w, "%s\n", err)
+		}
+	}
+	if werr != nil {
+		fmt.Fprintf(w, "%s\n", werr)
+		code = 1
+	}
+	return code
+}
+
 func defaultOpts() []hlb.ParseOption {
 	var opts []hlb.ParseOption
 	if isatty.IsTerminal(os.Stderr.Fd()) {
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/openllb/hlb"
+	cli "github.com/urfave/cli/v2"
+)
+
+var convertCommand = &cli.Command{
+	Name:  "convert",
+	Usage: "converts build definitions of other tools to HLB",
+	Subcommands: []*cli.Command{
+		convertDockerfileCommand,
+	},
+}
+
+var convertDockerfileCommand = &cli.Command{
+	Name:      "dockerfile",
+	Usage:     "converts a Dockerfile to a HLB program, keeping unsupported instructions as comments",
+	ArgsUsage: "[ <Dockerfile> ]",
+	Action: func(c *cli.Context) error {
+		if c.NArg() > 1 {
+			return fmt.Errorf("must have at most one argument")
+		}
+
+		r := os.Stdin
+		if c.NArg() == 1 {
+			f, err := os.Open(c.Args().First())
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		file, err := hlb.ConvertDockerfile(r)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(file)
+		return nil
+	},
+}
@@ -0,0 +1,50 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/openllb/hlb/codegen"
+	cli "github.com/urfave/cli/v2"
+)
+
+var debugCommand = &cli.Command{
+	Name:  "debug",
+	Usage: "inspects recorded debugger sessions",
+	Subcommands: []*cli.Command{
+		debugReplayCommand,
+	},
+}
+
+var debugReplayCommand = &cli.Command{
+	Name:      "replay",
+	Usage:     "steps through a session recorded with hlb run --debug-record",
+	ArgsUsage: "<session.json>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return fmt.Errorf("must have exactly one argument")
+		}
+
+		f, err := os.Open(c.Args().First())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		rec, err := codegen.ReadRecording(f)
+		if err != nil {
+			return err
+		}
+
+		err = codegen.Replay(os.Stderr, bufio.NewReader(os.Stdin), rec)
+		if err != nil {
+			// Ignore early exits from the debugger.
+			if err == codegen.ErrDebugExit {
+				return nil
+			}
+			return err
+		}
+		return nil
+	},
+}
@@ -0,0 +1,44 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/openllb/hlb/codegen"
+	cli "github.com/urfave/cli/v2"
+)
+
+var decompileCommand = &cli.Command{
+	Name:      "decompile",
+	Usage:     "reconstructs a HLB program from a LLB definition, such as one written by hlb run --llb",
+	ArgsUsage: "[ <llb.pb> ]",
+	Action: func(c *cli.Context) error {
+		if c.NArg() > 1 {
+			return fmt.Errorf("must have at most one argument")
+		}
+
+		r := os.Stdin
+		if c.NArg() == 1 {
+			f, err := os.Open(c.Args().First())
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		def, err := llb.ReadFrom(r)
+		if err != nil {
+			return err
+		}
+
+		file, err := codegen.Decompile(def)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(file)
+		return nil
+	},
+}
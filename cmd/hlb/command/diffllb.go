@@ -0,0 +1,51 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/openllb/hlb/codegen"
+	cli "github.com/urfave/cli/v2"
+)
+
+var diffLLBCommand = &cli.Command{
+	Name:      "diff-llb",
+	Usage:     "explains the vertices that changed between two LLB snapshots from hlb run --llb --format json",
+	ArgsUsage: "<a.json> <b.json>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			return fmt.Errorf("must have exactly two arguments")
+		}
+
+		a, err := readLLBSnapshot(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+
+		b, err := readLLBSnapshot(c.Args().Get(1))
+		if err != nil {
+			return err
+		}
+
+		changed, err := codegen.DiffLLBSnapshots(os.Stdout, a, b)
+		if err != nil {
+			return err
+		}
+
+		// Exit non-zero like diff when the snapshots differ.
+		if changed {
+			return cli.Exit("", 1)
+		}
+		return nil
+	},
+}
+
+func readLLBSnapshot(filename string) (*codegen.LLBSnapshot, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return codegen.ReadLLBSnapshot(f)
+}
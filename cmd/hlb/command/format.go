@@ -1,20 +1,21 @@
 package command
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 
 	"github.com/alecthomas/participle/lexer"
 	"github.com/openllb/hlb"
-	"github.com/openllb/hlb/report"
+	"github.com/openllb/hlb/ast"
 	cli "github.com/urfave/cli/v2"
 )
 
 var formatCommand = &cli.Command{
-	Name:    "format",
-	Aliases: []string{"fmt"},
-	Usage:   "formats HLB programs",
+	Name:      "format",
+	Aliases:   []string{"fmt"},
+	Usage:     "formats HLB programs",
 	ArgsUsage: "[ <*.hlb> ... ]",
 	Flags: []cli.Flag{
 		&cli.BoolFlag{
@@ -22,6 +23,16 @@ var formatCommand = &cli.Command{
 			Aliases: []string{"w"},
 			Usage:   "write result to (source) file instead of stdout",
 		},
+		&cli.BoolFlag{
+			Name:    "check",
+			Aliases: []string{"c"},
+			Usage:   "list files that are not formatted and exit non-zero if there are any",
+		},
+		&cli.BoolFlag{
+			Name:    "diff",
+			Aliases: []string{"d"},
+			Usage:   "print a unified diff of the changes instead of the result",
+		},
 	},
 	Action: func(c *cli.Context) error {
 		rs, cleanup, err := collectReaders(c)
@@ -30,33 +41,72 @@ var formatCommand = &cli.Command{
 		}
 		defer cleanup()
 
-		files, _, err := hlb.ParseMultiple(rs, defaultOpts()...)
+		files, ibs, err := hlb.ParseMultiple(rs, defaultOpts()...)
 		if err != nil {
 			return err
 		}
 
-		_, err = report.SemanticCheck(files...)
+		_, err = hlb.Check(files, ibs, defaultOpts()...)
 		if err != nil {
 			return err
 		}
 
-		if c.Bool("write") && c.NArg() > 0 {
-			for i, f := range files {
-				filename := lexer.NameOfReader(rs[i])
+		var (
+			write     = c.Bool("write") && c.NArg() > 0
+			check     = c.Bool("check")
+			diff      = c.Bool("diff")
+			unchanged = true
+		)
+
+		for i, f := range files {
+			filename := lexer.NameOfReader(rs[i])
+			if filename == "" {
+				filename = "<stdin>"
+			}
+
+			formatted := []byte(ast.Format(f))
+
+			var src []byte
+			if ib, ok := ibs[f.Pos.Filename]; ok {
+				src = ib.Bytes()
+			}
+
+			if bytes.Equal(src, formatted) {
+				if !write && !check && !diff {
+					fmt.Printf("%s", formatted)
+				}
+				continue
+			}
+			unchanged = false
+
+			if check {
+				fmt.Println(filename)
+			}
+
+			if diff {
+				_, err = hlb.WriteUnifiedDiff(os.Stdout, filename+".orig", filename, src, formatted)
+				if err != nil {
+					return err
+				}
+			}
+
+			if write {
 				info, err := os.Stat(filename)
 				if err != nil {
 					return err
 				}
 
-				err = ioutil.WriteFile(filename, []byte(f.String()), info.Mode())
+				err = ioutil.WriteFile(filename, formatted, info.Mode())
 				if err != nil {
 					return err
 				}
+			} else if !check && !diff {
+				fmt.Printf("%s", formatted)
 			}
-		} else {
-			for _, f := range files {
-				fmt.Printf("%s", f)
-			}
+		}
+
+		if check && !unchanged {
+			return cli.Exit("", 1)
 		}
 
 		return nil
@@ -1,10 +1,17 @@
 package command
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"path"
+	"path/filepath"
+	"strings"
 
+	"github.com/moby/buildkit/client"
 	"github.com/openllb/hlb"
 	"github.com/openllb/hlb/ast"
 	"github.com/openllb/hlb/codegen"
@@ -17,57 +24,200 @@ var getCommand = &cli.Command{
 	Name:      "get",
 	Usage:     "retrieves the HLB signatures from a HLB frontend",
 	ArgsUsage: "<image ref>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "update",
+			Aliases: []string{"u"},
+			Usage:   "updates existing signatures, showing how they changed and checking the HLB files calling them",
+		},
+		trustedKeysFlag,
+	},
 	Action: func(c *cli.Context) error {
 		if c.NArg() != 1 {
 			return fmt.Errorf("must have exactly one argument")
 		}
 
 		ref := c.Args().First()
-		frontendFile := fmt.Sprintf("%s.hlb", path.Base(ref))
-
-		entryName := "get"
-		getHLB := &ast.File{
-			Decls: []*ast.Decl{
-				{
-					Func: &ast.FuncDecl{
-						Type:   ast.NewType(ast.Filesystem),
-						Name:   ast.NewIdent(entryName),
-						Params: &ast.FieldList{},
-						Body: &ast.BlockStmt{
-							List: []*ast.Stmt{
-								ast.NewCallStmt("scratch", nil, nil, nil),
-								ast.NewCallStmt("copy", []*ast.Expr{
-									ast.NewBlockLitExpr(ast.Filesystem,
-										ast.NewCallStmt("image", []*ast.Expr{
-											ast.NewStringExpr(ref),
-										}, nil, nil),
-									),
-									ast.NewStringExpr(hlb.SignatureHLB),
-									ast.NewStringExpr(frontendFile),
-								}, nil, nil),
-							},
-						},
-					},
-				},
-			},
+		frontendFile := signatureFilename(ref)
+
+		var old []byte
+		if c.Bool("update") {
+			var err error
+			old, err = ioutil.ReadFile(frontendFile)
+			if err != nil {
+				return err
+			}
 		}
 
-		root, err := report.SemanticCheck(getHLB)
+		dir, err := ioutil.TempDir("", "hlb-get")
 		if err != nil {
 			return err
 		}
+		defer os.RemoveAll(dir)
 
-		st, _, err := codegen.Generate(ast.NewCallStmt(entryName, nil, nil, nil).Call, root)
+		ctx := context.Background()
+		cln, err := solver.BuildkitClient(ctx, c.String("addr"))
 		if err != nil {
 			return err
 		}
 
-		ctx := context.Background()
-		cln, err := solver.BuildkitClient(ctx, c.String("addr"))
+		if c.IsSet("trusted-keys") {
+			keys, err := hlb.LoadTrustedKeys(c.String("trusted-keys"))
+			if err != nil {
+				return err
+			}
+
+			err = hlb.FetchFrontend(ctx, cln, ref, dir)
+			if err != nil {
+				return err
+			}
+
+			err = hlb.VerifyBundle(dir, keys)
+			if err != nil {
+				return fmt.Errorf("frontend %s: %s", ref, err)
+			}
+		} else {
+			err = getSignature(ctx, cln, ref, dir)
+			if err != nil {
+				return err
+			}
+		}
+
+		updated, err := ioutil.ReadFile(filepath.Join(dir, hlb.SignatureHLB))
+		if err != nil {
+			return err
+		}
+
+		if !c.Bool("update") {
+			return ioutil.WriteFile(frontendFile, updated, hlb.HLBFileMode)
+		}
+
+		breaking, err := diffSignatures(os.Stdout, frontendFile, old, updated)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(frontendFile, updated, hlb.HLBFileMode)
+		if err != nil {
+			return err
+		}
+
+		if !breaking {
+			return nil
+		}
+
+		// Calls to functions whose signature changed incompatibly are
+		// semantic errors in the files next to the signatures.
+		rcs, err := readDir(".")
+		if err != nil {
+			return err
+		}
+
+		var rs []io.Reader
+		for _, rc := range rcs {
+			defer rc.Close()
+			rs = append(rs, rc)
+		}
+
+		files, ibs, err := hlb.ParseMultiple(rs, defaultOpts()...)
 		if err != nil {
 			return err
 		}
 
-		return solver.Solve(ctx, cln, st, solver.WithDownload("."))
+		_, err = hlb.Check(files, ibs, defaultOpts()...)
+		return err
 	},
 }
+
+// signatureFilename returns the name of the file that the signatures of a
+// frontend are written to, which is the name of its image without a tag or
+// digest.
+func signatureFilename(ref string) string {
+	name := path.Base(ref)
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	return fmt.Sprintf("%s.hlb", name)
+}
+
+// getSignature downloads the signatures of a frontend to a directory.
+func getSignature(ctx context.Context, cln *client.Client, ref, dest string) error {
+	entryName := "get"
+	getHLB := &ast.File{
+		Decls: []*ast.Decl{
+			{
+				Func: &ast.FuncDecl{
+					Type:   ast.NewType(ast.Filesystem),
+					Name:   ast.NewIdent(entryName),
+					Params: &ast.FieldList{},
+					Body: &ast.BlockStmt{
+						List: []*ast.Stmt{
+							ast.NewCallStmt("scratch", nil, nil, nil),
+							ast.NewCallStmt("copy", []*ast.Expr{
+								ast.NewBlockLitExpr(ast.Filesystem,
+									ast.NewCallStmt("image", []*ast.Expr{
+										ast.NewStringExpr(ref),
+									}, nil, nil),
+								),
+								ast.NewStringExpr(hlb.SignatureHLB),
+								ast.NewStringExpr(hlb.SignatureHLB),
+							}, nil, nil),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	root, err := report.SemanticCheck(getHLB)
+	if err != nil {
+		return err
+	}
+
+	st, _, err := codegen.Generate(ast.NewCallStmt(entryName, nil, nil, nil).Call, root)
+	if err != nil {
+		return err
+	}
+
+	return solver.Solve(ctx, cln, st, solver.WithDownload(dest))
+}
+
+// diffSignatures writes how signatures changed between two versions and
+// returns whether any change is incompatible with existing calls.
+func diffSignatures(w io.Writer, filename string, old, updated []byte) (bool, error) {
+	oldFile, _, err := hlb.Parse(bytes.NewReader(old))
+	if err != nil {
+		return false, err
+	}
+
+	updatedFile, _, err := hlb.Parse(bytes.NewReader(updated))
+	if err != nil {
+		return false, err
+	}
+
+	oldVersion, updatedVersion := hlb.SignatureVersion(oldFile), hlb.SignatureVersion(updatedFile)
+	if oldVersion != updatedVersion {
+		fmt.Fprintf(w, "%s: %s -> %s\n", filename, versionOrNone(oldVersion), versionOrNone(updatedVersion))
+	}
+
+	_, err = hlb.WriteUnifiedDiff(w, filename, filename, old, updated)
+	if err != nil {
+		return false, err
+	}
+
+	breaking := false
+	for _, change := range hlb.DiffSignatures(oldFile, updatedFile) {
+		if change.Breaking() {
+			breaking = true
+			fmt.Fprintf(w, "incompatible: %s\n", change)
+		}
+	}
+	return breaking, nil
+}
+
+func versionOrNone(version string) string {
+	if version == "" {
+		return "unversioned"
+	}
+	return version
+}
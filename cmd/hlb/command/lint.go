@@ -0,0 +1,95 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/lint"
+	cli "github.com/urfave/cli/v2"
+)
+
+var lintCommand = &cli.Command{
+	Name:      "lint",
+	Usage:     "warns about bad practice in HLB programs",
+	ArgsUsage: "[ <*.hlb> ... ]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "set format of diagnostics (text, json, sarif)",
+			Value: "text",
+		},
+		&cli.StringSliceFlag{
+			Name:  "disable",
+			Usage: "disable a lint rule by name",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		rules := lint.DefaultRules
+		if c.IsSet("disable") {
+			disabled, err := lint.FindRules(lint.DefaultRules, c.StringSlice("disable")...)
+			if err != nil {
+				return err
+			}
+
+			rules = nil
+			for _, rule := range lint.DefaultRules {
+				enabled := true
+				for _, d := range disabled {
+					if rule == d {
+						enabled = false
+					}
+				}
+				if enabled {
+					rules = append(rules, rule)
+				}
+			}
+		}
+
+		var write func(diagnostics []*lint.Diagnostic) error
+		switch c.String("format") {
+		case "text":
+			write = func(diagnostics []*lint.Diagnostic) error {
+				return lint.WriteText(os.Stdout, diagnostics)
+			}
+		case "json":
+			write = func(diagnostics []*lint.Diagnostic) error {
+				return lint.WriteJSON(os.Stdout, diagnostics)
+			}
+		case "sarif":
+			write = func(diagnostics []*lint.Diagnostic) error {
+				return lint.WriteSARIF(os.Stdout, rules, diagnostics)
+			}
+		default:
+			return fmt.Errorf("unrecognized format %q", c.String("format"))
+		}
+
+		rs, cleanup, err := collectReaders(c)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		files, ibs, err := hlb.ParseMultiple(rs, defaultOpts()...)
+		if err != nil {
+			return err
+		}
+
+		root, err := hlb.Check(files, ibs, defaultOpts()...)
+		if err != nil {
+			return err
+		}
+
+		diagnostics := lint.Lint(root, rules)
+
+		err = write(diagnostics)
+		if err != nil {
+			return err
+		}
+
+		if len(diagnostics) > 0 {
+			return cli.Exit("", 1)
+		}
+		return nil
+	},
+}
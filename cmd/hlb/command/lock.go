@@ -0,0 +1,84 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/codegen"
+	cli "github.com/urfave/cli/v2"
+)
+
+var lockCommand = &cli.Command{
+	Name:      "lock",
+	Usage:     "locks the images, git refs and http artifacts of targets to digests, commits and checksums",
+	ArgsUsage: "<*.hlb>",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "target",
+			Aliases: []string{"t"},
+			Usage:   "target filesystems to lock, which defaults to default",
+		},
+		&cli.StringFlag{
+			Name:  "lockfile",
+			Usage: "file to merge the lock into",
+			Value: hlb.LockFile,
+		},
+	},
+	Action: func(c *cli.Context) error {
+		rs, cleanup, err := collectReaders(c)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		files, ibs, err := hlb.ParseMultiple(rs, defaultOpts()...)
+		if err != nil {
+			return err
+		}
+
+		root, err := hlb.Check(files, ibs, defaultOpts()...)
+		if err != nil {
+			return err
+		}
+
+		targets := c.StringSlice("target")
+		if len(targets) == 0 {
+			targets = []string{"default"}
+		}
+
+		var sources []codegen.Source
+		for _, target := range targets {
+			_, info, err := codegen.Generate(ast.NewCallStmt(target, nil, nil, nil).Call, root)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, info.Sources...)
+		}
+
+		resolved, err := hlb.ResolveSources(context.Background(), sources)
+		if err != nil {
+			return err
+		}
+
+		// Sources are merged into an existing lock, so that locking some
+		// targets keeps the sources locked for the others.
+		lock, err := hlb.LoadLock(c.String("lockfile"))
+		if os.IsNotExist(err) {
+			lock = codegen.NewLock()
+		} else if err != nil {
+			return err
+		}
+		lock.Merge(resolved)
+
+		err = hlb.SaveLock(c.String("lockfile"), lock)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("locked %d images, %d git refs and %d http artifacts in %s\n", len(resolved.Images), len(resolved.Git), len(resolved.HTTP), c.String("lockfile"))
+		return nil
+	},
+}
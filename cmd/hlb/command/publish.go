@@ -3,6 +3,8 @@ package command
 import (
 	"context"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 
 	"github.com/openllb/hlb"
@@ -18,100 +20,183 @@ var publishCommand = &cli.Command{
 	Usage:     "compiles a HLB program and publishes it as a HLB frontend",
 	ArgsUsage: "<*.hlb>",
 	Flags: []cli.Flag{
-		&cli.StringFlag{
+		&cli.StringSliceFlag{
 			Name:    "target",
 			Aliases: []string{"t"},
-			Usage:   "target filesystem to compile",
-			Value:   "default",
+			Usage:   "target filesystems to publish, which defaults to default",
 		},
 		&cli.StringFlag{
 			Name:  "ref",
 			Usage: "frontend image reference",
 		},
+		&cli.StringFlag{
+			Name:  "version",
+			Usage: "semantic version of the signatures, which is also pushed as a tag of the frontend image",
+		},
+		&cli.StringFlag{
+			Name:  "sign-key",
+			Usage: "sign the signatures and sources with a PEM encoded ECDSA private key",
+		},
 	},
 	Action: func(c *cli.Context) error {
 		if !c.IsSet("ref") {
 			return fmt.Errorf("--ref must be specified")
 		}
 
+		// Signatures of a version call the frontend image tagged with it, so
+		// that publishing incompatible changes doesn't break them.
+		ref, refs := c.String("ref"), []string{c.String("ref")}
+		version := c.String("version")
+		if version != "" {
+			if !hlb.ValidVersion(version) {
+				return fmt.Errorf("--version must be a semantic version such as v1.2.3, found %q", version)
+			}
+			if strings.ContainsAny(path.Base(ref), ":@") {
+				return fmt.Errorf("--ref must not have a tag or digest with --version")
+			}
+
+			ref = fmt.Sprintf("%s:%s", ref, version)
+			refs = append(refs, ref)
+		}
+
 		rs, cleanup, err := collectReaders(c)
 		if err != nil {
 			return err
 		}
 		defer cleanup()
 
-		files, _, err := hlb.ParseMultiple(rs, defaultOpts()...)
+		files, ibs, err := hlb.ParseMultiple(rs, defaultOpts()...)
 		if err != nil {
 			return err
 		}
 
-		sourceRoot, err := report.SemanticCheck(files...)
+		sourceRoot, err := hlb.Check(files, ibs, defaultOpts()...)
 		if err != nil {
 			return err
 		}
 
-		var params []*ast.Field
-		ast.Inspect(sourceRoot, func(node ast.Node) bool {
-			switch n := node.(type) {
-			case *ast.FuncDecl:
-				if n.Name.Name == c.String("target") {
-					params = n.Params.List
-					return false
-				}
-			case *ast.AliasDecl:
-				if n.Ident.Name == c.String("target") {
-					params = n.Func.Params.List
-					return false
-				}
+		targets := c.StringSlice("target")
+		if len(targets) == 0 {
+			targets = []string{"default"}
+		}
+
+		// Each target is a function of the signature file that generates it
+		// with the frontend, so that one image serves every target.
+		signatureHLB := &ast.File{}
+		seen := make(map[string]struct{})
+		for _, target := range targets {
+			if _, ok := seen[target]; ok {
+				continue
+			}
+			seen[target] = struct{}{}
+
+			fun, err := signatureFunc(sourceRoot, target, ref, version)
+			if err != nil {
+				return err
 			}
-			return true
-		})
+			signatureHLB.Decls = append(signatureHLB.Decls, &ast.Decl{Func: fun})
+		}
+
+		ctx := context.Background()
 
-		frontendStmts := []*ast.Stmt{
-			ast.NewCallStmt("frontendOpt", []*ast.Expr{
-				ast.NewStringExpr("hlb-target"),
-				ast.NewStringExpr(c.String("target")),
+		// The base image is pinned to a digest and listed in the signed
+		// manifest, so that the frontend binary is signed with the sources.
+		base, err := hlb.ResolveImage(ctx, hlb.FrontendImage)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %s", hlb.FrontendImage, err)
+		}
+
+		baseImg, err := hlb.ImageConfig(ctx, base)
+		if err != nil {
+			return fmt.Errorf("failed to resolve config of %s: %s", base, err)
+		}
+
+		// Sources are published with their original layout, so that errors
+		// in the frontend point to the files they were published from.
+		sourceStmts := []*ast.Stmt{
+			ast.NewCallStmt("scratch", nil, nil, nil),
+			ast.NewCallStmt("mkdir", []*ast.Expr{
+				ast.NewStringExpr(hlb.SourcesDir),
+				ast.NewNumericExpr(int64(hlb.HLBDirMode), 8),
 			}, nil, nil),
 		}
-		for _, param := range params {
-			fun := "frontendOpt"
-			if param.Type.Type() == ast.Filesystem {
-				fun = "frontendInput"
+
+		// Published files by their path in the image, which are listed in the
+		// signed manifest.
+		published := make(map[string][]byte)
+
+		// Sources by the path they are published to, so that files that
+		// would overwrite each other are rejected.
+		sources := make(map[string]string)
+
+		dirs := make(map[string]struct{})
+		for _, f := range files {
+			filename := hlb.SourcePath(f.Pos.Filename)
+			if other, ok := sources[filename]; ok {
+				return fmt.Errorf("%s and %s are both published as %s", other, f.Pos.Filename, path.Join(hlb.SourcesDir, filename))
 			}
-			frontendStmts = append(frontendStmts, ast.NewCallStmt(fun, []*ast.Expr{
-				ast.NewStringExpr(param.Name.Name),
-				ast.NewIdentExpr(param.Name.Name),
-			}, nil, nil))
+			sources[filename] = f.Pos.Filename
+
+			dir := path.Dir(filename)
+			if _, ok := dirs[dir]; !ok && dir != "." {
+				dirs[dir] = struct{}{}
+				sourceStmts = append(sourceStmts, ast.NewCallStmt("mkdir", []*ast.Expr{
+					ast.NewStringExpr(path.Join(hlb.SourcesDir, dir)),
+					ast.NewNumericExpr(int64(hlb.HLBDirMode), 8),
+				}, ast.NewWithBlockLit(
+					ast.NewCallStmt("createParents", nil, nil, nil),
+				), nil))
+			}
+
+			published[path.Join(hlb.SourcesDir, filename)] = ibs[f.Pos.Filename].Bytes()
 		}
+		published[hlb.SignatureHLB] = []byte(signatureHLB.String())
+		published[hlb.SignatureBase] = []byte(base + "\n")
 
-		var sources []string
-		for _, f := range files {
-			sources = append(sources, f.String())
+		if c.IsSet("sign-key") {
+			key, err := hlb.LoadSigningKey(c.String("sign-key"))
+			if err != nil {
+				return err
+			}
+
+			manifest := hlb.NewManifest(published)
+			sig, err := hlb.SignManifest(key, manifest)
+			if err != nil {
+				return err
+			}
+
+			published[hlb.SignatureManifest] = manifest
+			published[hlb.SignatureSig] = sig
 		}
 
-		signatureHLB := &ast.File{
-			Decls: []*ast.Decl{
-				{
-					Func: &ast.FuncDecl{
-						Type: ast.NewType(ast.Filesystem),
-						Name: ast.NewIdent(c.String("target")),
-						Params: &ast.FieldList{
-							List: params,
-						},
-						Body: &ast.BlockStmt{
-							List: []*ast.Stmt{
-								ast.NewCallStmt("generate", []*ast.Expr{
-									ast.NewBlockLitExpr(ast.Filesystem,
-										ast.NewCallStmt("image", []*ast.Expr{
-											ast.NewStringExpr(c.String("ref")),
-										}, nil, nil),
-									),
-								}, ast.NewWithBlockLit(frontendStmts...), nil),
-							},
-						},
-					},
-				},
-			},
+		var publishedPaths []string
+		for p := range published {
+			publishedPaths = append(publishedPaths, p)
+		}
+		sort.Strings(publishedPaths)
+
+		for _, p := range publishedPaths {
+			sourceStmts = append(sourceStmts, ast.NewCallStmt("mkfile", []*ast.Expr{
+				ast.NewStringExpr(p),
+				ast.NewNumericExpr(int64(hlb.HLBFileMode), 8),
+				ast.NewStringExpr(string(published[p])),
+			}, nil, nil))
+		}
+
+		// The published files are copied onto the base in one layer, and the
+		// frontend is pushed with the config of the base, so that verifying
+		// the frontend can check that nothing else changed.
+		publishStmts := []*ast.Stmt{
+			ast.NewCallStmt("image", []*ast.Expr{
+				ast.NewStringExpr(base),
+			}, nil, nil),
+			ast.NewCallStmt("copy", []*ast.Expr{
+				ast.NewBlockLitExpr(ast.Filesystem, sourceStmts...),
+				ast.NewStringExpr("/"),
+				ast.NewStringExpr("/"),
+			}, ast.NewWithBlockLit(
+				ast.NewCallStmt("contentsOnly", nil, nil, nil),
+			), nil),
 		}
 
 		entryName := "publish_hlb"
@@ -123,21 +208,7 @@ var publishCommand = &cli.Command{
 						Name:   ast.NewIdent(entryName),
 						Params: &ast.FieldList{},
 						Body: &ast.BlockStmt{
-							List: []*ast.Stmt{
-								ast.NewCallStmt("image", []*ast.Expr{
-									ast.NewStringExpr("openllb/hlb"),
-								}, nil, nil),
-								ast.NewCallStmt("mkfile", []*ast.Expr{
-									ast.NewStringExpr(hlb.SourceHLB),
-									ast.NewNumericExpr(int64(hlb.HLBFileMode), 8),
-									ast.NewStringExpr(strings.Join(sources, "")),
-								}, nil, nil),
-								ast.NewCallStmt("mkfile", []*ast.Expr{
-									ast.NewStringExpr(hlb.SignatureHLB),
-									ast.NewNumericExpr(int64(hlb.HLBFileMode), 8),
-									ast.NewStringExpr(signatureHLB.String()),
-								}, nil, nil),
-							},
+							List: publishStmts,
 						},
 					},
 				},
@@ -154,12 +225,91 @@ var publishCommand = &cli.Command{
 			return err
 		}
 
-		ctx := context.Background()
 		cln, err := solver.BuildkitClient(ctx, c.String("addr"))
 		if err != nil {
 			return err
 		}
 
-		return solver.Solve(ctx, cln, st, solver.WithPushImage(c.String("ref")))
+		for _, ref := range refs {
+			err = solver.Solve(ctx, cln, st, solver.WithPushImage(ref), solver.WithImageSpec(baseImg))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	},
 }
+
+// signatureFunc returns a function with the params of a target that generates
+// it with the frontend published to ref.
+func signatureFunc(root *ast.AST, target, ref, version string) (*ast.FuncDecl, error) {
+	obj := root.Scope.Lookup(target)
+	if obj == nil {
+		return nil, fmt.Errorf("target %q is not defined", target)
+	}
+
+	var params []*ast.Field
+	switch n := obj.Node.(type) {
+	case *ast.FuncDecl:
+		if n.Type.Type() != ast.Filesystem {
+			return nil, fmt.Errorf("target %q must be a fs, found %s", target, n.Type)
+		}
+		params = n.Params.List
+	case *ast.AliasDecl:
+		params = n.Func.Params.List
+	default:
+		return nil, fmt.Errorf("target %q is not a function", target)
+	}
+
+	frontendStmts := []*ast.Stmt{
+		ast.NewCallStmt("frontendOpt", []*ast.Expr{
+			ast.NewStringExpr(hlb.OptTarget),
+			ast.NewStringExpr(target),
+		}, nil, nil),
+	}
+	if version != "" {
+		frontendStmts = append(frontendStmts, ast.NewCallStmt("frontendOpt", []*ast.Expr{
+			ast.NewStringExpr(hlb.OptVersion),
+			ast.NewStringExpr(version),
+		}, nil, nil))
+	}
+	for _, param := range params {
+		fun := "frontendOpt"
+		if param.Type.Type() == ast.Filesystem {
+			fun = "frontendInput"
+		}
+		frontendStmts = append(frontendStmts, ast.NewCallStmt(fun, []*ast.Expr{
+			ast.NewStringExpr(param.Name.Name),
+			ast.NewIdentExpr(param.Name.Name),
+		}, nil, nil))
+	}
+
+	// Option params are passed to the frontend as JSON, see
+	// hlb.ParseOptionOpt.
+	var signatureParams []*ast.Field
+	for _, param := range params {
+		if param.Type.Type() == ast.Option {
+			param = ast.NewField(ast.Str, param.Name.Name, false)
+		}
+		signatureParams = append(signatureParams, param)
+	}
+
+	return &ast.FuncDecl{
+		Type: ast.NewType(ast.Filesystem),
+		Name: ast.NewIdent(target),
+		Params: &ast.FieldList{
+			List: signatureParams,
+		},
+		Body: &ast.BlockStmt{
+			List: []*ast.Stmt{
+				ast.NewCallStmt("generate", []*ast.Expr{
+					ast.NewBlockLitExpr(ast.Filesystem,
+						ast.NewCallStmt("image", []*ast.Expr{
+							ast.NewStringExpr(ref),
+						}, nil, nil),
+					),
+				}, ast.NewWithBlockLit(frontendStmts...), nil),
+			},
+		},
+	}, nil
+}
@@ -28,6 +28,14 @@ var runCommand = &cli.Command{
 			Name:  "debug",
 			Usage: "compile using a debugger",
 		},
+		&cli.StringFlag{
+			Name:  "debug-init",
+			Usage: "run debugger commands from a file, checking any expected output",
+		},
+		&cli.StringFlag{
+			Name:  "debug-record",
+			Usage: "record the debugger session to a file for replaying with hlb debug replay",
+		},
 		&cli.StringFlag{
 			Name:    "download",
 			Aliases: []string{"d"},
@@ -50,11 +58,31 @@ var runCommand = &cli.Command{
 			Name:  "llb",
 			Usage: "output the LLB to stdout instead of solving it",
 		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "set format of the LLB output (pb, json)",
+			Value: "pb",
+		},
 		&cli.StringFlag{
 			Name:    "push",
 			Aliases: []string{"p"},
 			Usage:   "push the solved hlb filesystem to a docker registry",
 		},
+		trustedKeysFlag,
+		&cli.StringFlag{
+			Name:  "lockfile",
+			Usage: "substitute remote sources with their locked values in a lock written by hlb lock, if it exists",
+			Value: hlb.LockFile,
+		},
+		&cli.BoolFlag{
+			Name:  "locked",
+			Usage: "fail if the lock is missing or doesn't lock every remote source, unused sources in the lock are not reported",
+		},
+		&cli.BoolFlag{
+			Name:  "offline",
+			Usage: "replace git and http sources with their copies vendored by hlb vendor, images are still pulled by BuildKit",
+		},
+		vendorDirFlag,
 	},
 	Action: func(c *cli.Context) error {
 		var r io.Reader
@@ -83,7 +111,54 @@ var runCommand = &cli.Command{
 			return err
 		}
 
-		st, info, err := hlb.Compile(ctx, cln, c.String("target"), []io.Reader{r}, c.Bool("debug"))
+		compileOpts := []hlb.CompileOption{hlb.WithDebug(c.Bool("debug"))}
+		if c.IsSet("debug-init") {
+			f, err := os.Open(c.String("debug-init"))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			// Fall back to an interactive debugger when the commands run out.
+			var fallback io.Reader
+			if c.Bool("debug") {
+				fallback = os.Stdin
+			}
+
+			script, err := codegen.NewScript(c.String("debug-init"), f, os.Stderr, fallback)
+			if err != nil {
+				return err
+			}
+
+			compileOpts = append(compileOpts, hlb.WithDebugScript(script))
+		}
+		if c.IsSet("trusted-keys") {
+			keys, err := hlb.LoadTrustedKeys(c.String("trusted-keys"))
+			if err != nil {
+				return err
+			}
+
+			compileOpts = append(compileOpts, hlb.WithTrustedKeys(keys))
+		}
+		lock, err := hlb.LoadLock(c.String("lockfile"))
+		if err != nil && (c.Bool("locked") || !os.IsNotExist(err)) {
+			return err
+		}
+		compileOpts = append(compileOpts, hlb.WithLock(lock, c.Bool("locked")))
+		if c.Bool("offline") {
+			compileOpts = append(compileOpts, hlb.WithOffline(c.String("vendor-dir")))
+		}
+		if c.IsSet("debug-record") {
+			f, err := os.Create(c.String("debug-record"))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			compileOpts = append(compileOpts, hlb.WithDebugRecord(f))
+		}
+
+		st, info, err := hlb.Compile(ctx, cln, c.String("target"), []io.Reader{r}, compileOpts...)
 		if err != nil {
 			// Ignore early exits from the debugger.
 			if err == codegen.ErrDebugExit {
@@ -98,7 +173,19 @@ var runCommand = &cli.Command{
 				return err
 			}
 
-			return llb.WriteTo(def, os.Stdout)
+			switch c.String("format") {
+			case "pb":
+				return llb.WriteTo(def, os.Stdout)
+			case "json":
+				snapshot, err := codegen.NewLLBSnapshot(def)
+				if err != nil {
+					return err
+				}
+
+				return snapshot.Encode(os.Stdout)
+			default:
+				return fmt.Errorf("unrecognized format %q", c.String("format"))
+			}
 		}
 
 		var solveOpts []solver.SolveOption
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/solver"
+	cli "github.com/urfave/cli/v2"
+)
+
+var testCommand = &cli.Command{
+	Name:      "test",
+	Usage:     "compiles and runs the test functions of HLB programs",
+	ArgsUsage: "[ <*.hlb> ... ]",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "run",
+			Usage: "only run tests matching a regular expression",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "set format of test results (tap, junit)",
+			Value: "tap",
+		},
+		&cli.IntFlag{
+			Name:  "parallel",
+			Usage: "maximum number of tests to solve in parallel",
+			Value: 4,
+		},
+	},
+	Action: func(c *cli.Context) error {
+		var write func(results []*hlb.TestResult) error
+		switch c.String("format") {
+		case "tap":
+			write = func(results []*hlb.TestResult) error {
+				return hlb.WriteTAP(os.Stdout, results)
+			}
+		case "junit":
+			write = func(results []*hlb.TestResult) error {
+				return hlb.WriteJUnit(os.Stdout, results)
+			}
+		default:
+			return fmt.Errorf("unrecognized format %q", c.String("format"))
+		}
+
+		testOpts := []hlb.TestOption{hlb.WithTestParallel(c.Int("parallel"))}
+		if c.IsSet("run") {
+			run, err := regexp.Compile(c.String("run"))
+			if err != nil {
+				return err
+			}
+			testOpts = append(testOpts, hlb.WithTestRun(run))
+		}
+
+		rs, cleanup, err := collectReaders(c)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		ctx := context.Background()
+		cln, err := solver.BuildkitClient(ctx, c.String("addr"))
+		if err != nil {
+			return err
+		}
+
+		results, err := hlb.Test(ctx, cln, rs, testOpts...)
+		if err != nil {
+			return err
+		}
+
+		err = write(results)
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, result := range results {
+			if !result.Passed() {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d tests failed", failed, len(results))
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,82 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/solver"
+	cli "github.com/urfave/cli/v2"
+)
+
+var vendorCommand = &cli.Command{
+	Name:      "vendor",
+	Usage:     "downloads the git repositories and http artifacts of targets for building offline, images are not vendored",
+	ArgsUsage: "<*.hlb>",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "target",
+			Aliases: []string{"t"},
+			Usage:   "target filesystems to vendor, which defaults to default",
+		},
+		&cli.StringFlag{
+			Name:  "lockfile",
+			Usage: "vendor the locked values of remote sources in a lock written by hlb lock, if it exists",
+			Value: hlb.LockFile,
+		},
+		vendorDirFlag,
+	},
+	Action: func(c *cli.Context) error {
+		rs, cleanup, err := collectReaders(c)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		files, ibs, err := hlb.ParseMultiple(rs, defaultOpts()...)
+		if err != nil {
+			return err
+		}
+
+		root, err := hlb.Check(files, ibs, defaultOpts()...)
+		if err != nil {
+			return err
+		}
+
+		lock, err := hlb.LoadLock(c.String("lockfile"))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		targets := c.StringSlice("target")
+		if len(targets) == 0 {
+			targets = []string{"default"}
+		}
+
+		var sources []codegen.Source
+		for _, target := range targets {
+			_, info, err := codegen.Generate(ast.NewCallStmt(target, nil, nil, nil).Call, root, codegen.WithLock(lock, false))
+			if err != nil {
+				return err
+			}
+			sources = append(sources, info.Sources...)
+		}
+
+		ctx := context.Background()
+		cln, err := solver.BuildkitClient(ctx, c.String("addr"))
+		if err != nil {
+			return err
+		}
+
+		n, err := hlb.VendorSources(ctx, cln, c.String("vendor-dir"), sources)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("vendored %d sources to %s\n", n, c.String("vendor-dir"))
+		return nil
+	},
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/openllb/hlb/cmd/hlb/command"
@@ -9,8 +8,6 @@ import (
 
 func main() {
 	app := command.App()
-	if err := app.Run(os.Args); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(1)
-	}
+	err := app.Run(os.Args)
+	os.Exit(command.HandleError(os.Stderr, err))
 }
@@ -0,0 +1,84 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/openllb/hlb/ast"
+)
+
+// Assertion is a check on a filesystem at the point an assert statement is
+// reached. The filesystem is never changed by an assertion.
+type Assertion struct {
+	// Call is the assert statement.
+	Call *ast.CallStmt
+
+	// State is the filesystem that must solve for the assertion to pass.
+	State llb.State
+
+	// Path is the absolute path of the file being asserted on, if any.
+	Path string
+
+	// Content is the expected content of the file at Path, if any.
+	Content *string
+}
+
+// String returns the assert statement without its statement end.
+func (a *Assertion) String() string {
+	call := *a.Call
+	call.StmtEnd = nil
+	return call.String()
+}
+
+func emitAssertion(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt, v interface{}) error {
+	st, ok := v.(llb.State)
+	if !ok {
+		return ErrWrongType{call, string(ast.Filesystem), v}
+	}
+
+	err := checkNumArgs(ast.Filesystem, call)
+	if err != nil {
+		return err
+	}
+
+	assertion := &Assertion{
+		Call:  call,
+		State: st,
+	}
+
+	args := call.Args
+	switch call.Func.Name {
+	case "assertExists":
+		path, err := emitStringExpr(info, scope, call, args[0])
+		if err != nil {
+			return err
+		}
+		assertion.Path = debugPath(st, path)
+	case "assertContent":
+		path, err := emitStringExpr(info, scope, call, args[0])
+		if err != nil {
+			return err
+		}
+
+		content, err := emitStringExpr(info, scope, call, args[1])
+		if err != nil {
+			return err
+		}
+
+		assertion.Path = debugPath(st, path)
+		assertion.Content = &content
+	case "assertRun":
+		shlex, err := emitShlex(info, scope, call, args)
+		if err != nil {
+			return err
+		}
+
+		// The command must exit zero for its filesystem to solve.
+		assertion.State = st.Run(llb.Shlex(shlex)).Root()
+	default:
+		return ErrUnsupported{call, fmt.Sprintf("assertion %s", call.Func)}
+	}
+
+	info.Assertions = append(info.Assertions, assertion)
+	return nil
+}
@@ -66,8 +66,27 @@ func Generate(call *ast.CallStmt, root *ast.AST, opts ...CodeGenOption) (llb.Sta
 type CodeGenOption func(*CodeGenInfo) error
 
 type CodeGenInfo struct {
-	Debug  Debugger
-	Locals map[string]string
+	Debug      Debugger
+	Locals     map[string]string
+	Assertions []*Assertion
+
+	// Sources are the remote sources emitted, which are substituted with
+	// their value in Lock if there is one.
+	Sources []Source
+	Lock    *Lock
+	Locked  bool
+
+	// VendorDir is the directory remote sources were vendored to, which
+	// replace them when generating offline.
+	VendorDir string
+
+	// emitting is the set of func calls being emitted, to catch recursion.
+	emitting map[emitKey]struct{}
+}
+
+type emitKey struct {
+	fun  *ast.FuncDecl
+	call *ast.CallStmt
 }
 
 func WithDebugger(dbgr Debugger) CodeGenOption {
@@ -77,13 +96,20 @@ func WithDebugger(dbgr Debugger) CodeGenOption {
 	}
 }
 
+// WithLocals sets the map that the local directories of the target are
+// recorded in, so that they can be shared with a debugger.
+func WithLocals(locals map[string]string) CodeGenOption {
+	return func(i *CodeGenInfo) error {
+		i.Locals = locals
+		return nil
+	}
+}
+
 type aliasCallback func(*ast.CallStmt, interface{})
 
 func noopAliasCallback(_ *ast.CallStmt, _ interface{}) {}
 
 func emitBlock(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjType, stmts []*ast.Stmt, ac aliasCallback) (interface{}, error) {
-	index := 0
-
 	var v interface{}
 	switch typ {
 	case ast.Filesystem:
@@ -92,6 +118,7 @@ func emitBlock(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjType, stmts []*as
 		v = ""
 	}
 
+	index := -1
 	for i, stmt := range stmts {
 		if report.Contains(report.Debugs, stmt.Call.Func.Name) {
 			err := info.Debug(scope, stmt.Call, v)
@@ -105,6 +132,11 @@ func emitBlock(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjType, stmts []*as
 		break
 	}
 
+	// Blocks without a source are left empty.
+	if index < 0 {
+		return v, nil
+	}
+
 	// Before executing a source call statement.
 	sourceStmt := stmts[index].Call
 	err := info.Debug(scope, sourceStmt, v)
@@ -117,6 +149,11 @@ func emitBlock(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjType, stmts []*as
 		return nil, err
 	}
 
+	// Chain statements can only be applied to a source of the block type.
+	if typeName(v) != string(typ) {
+		return nil, ErrWrongType{sourceStmt, string(typ), v}
+	}
+
 	if sourceStmt.Alias != nil {
 		// Source statements may be aliased.
 		ac(sourceStmt, v)
@@ -138,6 +175,15 @@ func emitBlock(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjType, stmts []*as
 			return nil, err
 		}
 
+		if report.Contains(report.Asserts, call.Func.Name) {
+			// Assertions check the current value without changing it.
+			err = emitAssertion(info, scope, call, v)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
 		chain, err := emitChainStmt(info, scope, typ, call, ac)
 		if err != nil {
 			return nil, err
@@ -172,12 +218,12 @@ func emitChainStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjType, call *a
 			return chain(v.(string))
 		}, nil
 	default:
-		panic("unknown chain stmt")
+		return nil, ErrUnsupported{call, fmt.Sprintf("%s chain stmt", typ)}
 	}
 }
 
 func emitStringChainStmt(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt) (func(string) string, error) {
-	panic("unimplemented")
+	return nil, ErrUnsupported{call, "string chain stmt"}
 }
 
 func emitFilesystemBlock(info *CodeGenInfo, scope *ast.Scope, stmts []*ast.Stmt, ac aliasCallback) (llb.State, error) {
@@ -196,35 +242,26 @@ func emitStringBlock(info *CodeGenInfo, scope *ast.Scope, stmts []*ast.Stmt) (st
 	return v.(string), nil
 }
 
-func emitBlockLit(info *CodeGenInfo, scope *ast.Scope, lit *ast.BlockLit, op string, ac aliasCallback) (interface{}, error) {
-	switch lit.Type.Type() {
-	case ast.Int, ast.Bool:
-		panic("unimplemented")
-	case ast.Filesystem:
-		return emitFilesystemBlock(info, scope, lit.Body.NonEmptyStmts(), ac)
-	case ast.Str:
-		return emitStringBlock(info, scope, lit.Body.NonEmptyStmts())
-	case ast.Option:
-		return emitOptions(info, scope, op, lit.Body.NonEmptyStmts(), ac)
-	}
-	return nil, nil
-}
-
 func emitSourceStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjType, call *ast.CallStmt, ac aliasCallback) (interface{}, error) {
 	_, ok := report.Builtins[typ][call.Func.Name]
 	if ok {
+		err := checkNumArgs(typ, call)
+		if err != nil {
+			return nil, err
+		}
+
 		switch typ {
 		case ast.Filesystem:
 			return emitFilesystemSourceStmt(info, scope, call, ac)
 		case ast.Str:
 			return emitStringSourceStmt(info, scope, call, ac)
 		default:
-			panic("unimplemented")
+			return nil, ErrUnsupported{call, fmt.Sprintf("%s source", typ)}
 		}
 	} else {
-		obj := scope.Lookup(call.Func.Name)
-		if obj == nil {
-			panic(call.Func.Name)
+		obj, err := lookup(scope, call.Func)
+		if err != nil {
+			return nil, err
 		}
 
 		switch n := obj.Node.(type) {
@@ -235,7 +272,7 @@ func emitSourceStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjType, call *
 		case *ast.Field:
 			return obj.Data, nil
 		default:
-			panic("unknown obj type")
+			return nil, ErrUnsupported{call, "source object"}
 		}
 	}
 }
@@ -258,11 +295,24 @@ func emitFilesystemSourceStmt(info *CodeGenInfo, scope *ast.Scope, call *ast.Cal
 
 		var opts []llb.ImageOption
 		for _, iopt := range iopts {
-			opt := iopt.(llb.ImageOption)
+			opt, ok := iopt.(llb.ImageOption)
+			if !ok {
+				return st, ErrWrongType{call, "option::image", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
-		return llb.Image(ref, opts...), nil
+		key := ref
+		locked, err := lockSource(info, call, SourceImage, key)
+		if err != nil {
+			return st, err
+		}
+		if locked != "" {
+			ref = locked
+		}
+
+		opts = append(opts, withSourcePosition(call))
+		return emitRemoteSource(info, Source{SourceImage, key, locked, call, llb.Image(ref, opts...)})
 	case "http":
 		url, err := emitStringExpr(info, scope, call, args[0])
 		if err != nil {
@@ -271,11 +321,23 @@ func emitFilesystemSourceStmt(info *CodeGenInfo, scope *ast.Scope, call *ast.Cal
 
 		var opts []llb.HTTPOption
 		for _, iopt := range iopts {
-			opt := iopt.(llb.HTTPOption)
+			opt, ok := iopt.(llb.HTTPOption)
+			if !ok {
+				return st, ErrWrongType{call, "option::http", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
-		return llb.HTTP(url, opts...), nil
+		checksum, err := lockSource(info, call, SourceHTTP, url)
+		if err != nil {
+			return st, err
+		}
+		if checksum != "" {
+			opts = append(opts, llb.Checksum(digest.Digest(checksum)))
+		}
+
+		opts = append(opts, withSourcePosition(call))
+		return emitRemoteSource(info, Source{SourceHTTP, url, checksum, call, llb.HTTP(url, opts...)})
 	case "git":
 		remote, err := emitStringExpr(info, scope, call, args[0])
 		if err != nil {
@@ -288,11 +350,24 @@ func emitFilesystemSourceStmt(info *CodeGenInfo, scope *ast.Scope, call *ast.Cal
 
 		var opts []llb.GitOption
 		for _, iopt := range iopts {
-			opt := iopt.(llb.GitOption)
+			opt, ok := iopt.(llb.GitOption)
+			if !ok {
+				return st, ErrWrongType{call, "option::git", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
-		return llb.Git(remote, ref, opts...), nil
+		key := fmt.Sprintf("%s#%s", remote, ref)
+		commit, err := lockSource(info, call, SourceGit, key)
+		if err != nil {
+			return st, err
+		}
+		if commit != "" {
+			ref = commit
+		}
+
+		opts = append(opts, withSourcePosition(call))
+		return emitRemoteSource(info, Source{SourceGit, key, commit, call, llb.Git(remote, ref, opts...)})
 	case "local":
 		path, err := emitStringExpr(info, scope, call, args[0])
 		if err != nil {
@@ -301,7 +376,10 @@ func emitFilesystemSourceStmt(info *CodeGenInfo, scope *ast.Scope, call *ast.Cal
 
 		var opts []llb.LocalOption
 		for _, iopt := range iopts {
-			opt := iopt.(llb.LocalOption)
+			opt, ok := iopt.(llb.LocalOption)
+			if !ok {
+				return st, ErrWrongType{call, "option::local", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
@@ -320,6 +398,7 @@ func emitFilesystemSourceStmt(info *CodeGenInfo, scope *ast.Scope, call *ast.Cal
 		id := string(digest.FromBytes(hashInput))
 		info.Locals[id] = path
 
+		opts = append(opts, withSourcePosition(call))
 		return llb.Local(id, opts...), nil
 	case "generate":
 		frontend, err := emitFilesystemExpr(info, scope, nil, args[0], ac)
@@ -329,13 +408,16 @@ func emitFilesystemSourceStmt(info *CodeGenInfo, scope *ast.Scope, call *ast.Cal
 
 		opts := []llb.FrontendOption{llb.IgnoreCache}
 		for _, iopt := range iopts {
-			opt := iopt.(llb.FrontendOption)
+			opt, ok := iopt.(llb.FrontendOption)
+			if !ok {
+				return st, ErrWrongType{call, "option::generate", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
 		return llb.Frontend(frontend, opts...), nil
 	default:
-		panic("unknown fs source stmt")
+		return st, ErrUnsupported{call, fmt.Sprintf("fs source %s", call.Func)}
 	}
 }
 
@@ -361,7 +443,7 @@ func emitStringSourceStmt(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStm
 
 		return fmt.Sprintf(formatStr, as...), nil
 	default:
-		panic("unknown string source stmt")
+		return "", ErrUnsupported{call, fmt.Sprintf("string source %s", call.Func)}
 	}
 }
 
@@ -372,21 +454,41 @@ func emitWithOption(info *CodeGenInfo, scope *ast.Scope, parent *ast.CallStmt, w
 
 	switch {
 	case with.Ident != nil:
-		obj := scope.Lookup(with.Ident.Name)
+		obj, err := lookup(scope, with.Ident)
+		if err != nil {
+			return nil, err
+		}
+
 		switch obj.Kind {
+		case ast.DeclKind:
+			switch n := obj.Node.(type) {
+			case *ast.FuncDecl:
+				return emitOptionFuncDecl(info, scope, n, nil, parent.Func.Name)
+			default:
+				return nil, ErrUnsupported{with, "with option decl"}
+			}
 		case ast.ExprKind:
-			return obj.Data.([]interface{}), nil
+			iopts, ok := obj.Data.([]interface{})
+			if !ok {
+				return nil, ErrWrongType{with, "option", obj.Data}
+			}
+			return iopts, nil
 		default:
-			panic("unknown with option kind")
+			return nil, ErrUnsupported{with, "with option object"}
 		}
 	case with.BlockLit != nil:
 		return emitOptions(info, scope, parent.Func.Name, with.BlockLit.Body.NonEmptyStmts(), ac)
 	default:
-		panic("unknown with option")
+		return nil, ErrUnsupported{with, "with option"}
 	}
 }
 
 func emitFilesystemChainStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjType, call *ast.CallStmt, ac aliasCallback) (so llb.StateOption, err error) {
+	err = checkNumArgs(typ, call)
+	if err != nil {
+		return so, err
+	}
+
 	args := call.Args
 	iopts, err := emitWithOption(info, scope, call, call.WithOpt, ac)
 	if err != nil {
@@ -395,38 +497,17 @@ func emitFilesystemChainStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjTyp
 
 	switch call.Func.Name {
 	case "run":
-		var shlex string
-		if len(args) == 1 {
-			commandStr, err := emitStringExpr(info, scope, call, args[0])
-			if err != nil {
-				return so, err
-			}
-
-			parts, err := shellquote.Split(commandStr)
-			if err != nil {
-				return so, err
-			}
-
-			if len(parts) == 1 {
-				shlex = commandStr
-			} else {
-				shlex = shellquote.Join("/bin/sh", "-c", commandStr)
-			}
-		} else {
-			var runArgs []string
-			for _, arg := range args {
-				runArg, err := emitStringExpr(info, scope, call, arg)
-				if err != nil {
-					return so, err
-				}
-				runArgs = append(runArgs, runArg)
-			}
-			shlex = shellquote.Join(runArgs...)
+		shlex, err := emitShlex(info, scope, call, args)
+		if err != nil {
+			return so, err
 		}
 
 		var opts []llb.RunOption
 		for _, iopt := range iopts {
-			opt := iopt.(llb.RunOption)
+			opt, ok := iopt.(llb.RunOption)
+			if !ok {
+				return so, ErrWrongType{call, "option::run", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
@@ -447,6 +528,11 @@ func emitFilesystemChainStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjTyp
 						continue
 					}
 
+					err = checkNumArgs(ast.OptionRun, stmt.Call)
+					if err != nil {
+						return so, err
+					}
+
 					target, err := emitStringExpr(info, scope, call, stmt.Call.Args[1])
 					if err != nil {
 						return so, err
@@ -456,11 +542,11 @@ func emitFilesystemChainStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjTyp
 					targets = append(targets, target)
 				}
 			default:
-				panic("unknown with option")
+				return so, ErrUnsupported{with, "with option"}
 			}
 		}
 
-		opts = append(opts, llb.Shlex(shlex))
+		opts = append(opts, llb.Shlex(shlex), withSourcePosition(call))
 		so = func(st llb.State) llb.State {
 			exec := st.Run(opts...)
 
@@ -537,13 +623,17 @@ func emitFilesystemChainStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjTyp
 
 		var opts []llb.MkdirOption
 		for _, iopt := range iopts {
-			opt := iopt.(llb.MkdirOption)
+			opt, ok := iopt.(llb.MkdirOption)
+			if !ok {
+				return so, ErrWrongType{call, "option::mkdir", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
 		so = func(st llb.State) llb.State {
 			return st.File(
 				llb.Mkdir(path, os.FileMode(mode), opts...),
+				withSourcePosition(call),
 			)
 		}
 	case "mkfile":
@@ -564,13 +654,17 @@ func emitFilesystemChainStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjTyp
 
 		var opts []llb.MkfileOption
 		for _, iopt := range iopts {
-			opt := iopt.(llb.MkfileOption)
+			opt, ok := iopt.(llb.MkfileOption)
+			if !ok {
+				return so, ErrWrongType{call, "option::mkfile", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
 		so = func(st llb.State) llb.State {
 			return st.File(
 				llb.Mkfile(path, os.FileMode(mode), []byte(content), opts...),
+				withSourcePosition(call),
 			)
 		}
 	case "rm":
@@ -581,13 +675,17 @@ func emitFilesystemChainStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjTyp
 
 		var opts []llb.RmOption
 		for _, iopt := range iopts {
-			opt := iopt.(llb.RmOption)
+			opt, ok := iopt.(llb.RmOption)
+			if !ok {
+				return so, ErrWrongType{call, "option::rm", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
 		so = func(st llb.State) llb.State {
 			return st.File(
 				llb.Rm(path, opts...),
+				withSourcePosition(call),
 			)
 		}
 	case "copy":
@@ -608,21 +706,74 @@ func emitFilesystemChainStmt(info *CodeGenInfo, scope *ast.Scope, typ ast.ObjTyp
 
 		var opts []llb.CopyOption
 		for _, iopt := range iopts {
-			opt := iopt.(llb.CopyOption)
+			opt, ok := iopt.(llb.CopyOption)
+			if !ok {
+				return so, ErrWrongType{call, "option::copy", iopt}
+			}
 			opts = append(opts, opt)
 		}
 
 		so = func(st llb.State) llb.State {
 			return st.File(
 				llb.Copy(input, src, dest, opts...),
+				withSourcePosition(call),
 			)
 		}
+	default:
+		return so, ErrUnsupported{call, fmt.Sprintf("fs op %s", call.Func)}
 	}
 
 	return so, nil
 }
 
+// emitShlex returns the command line for the arguments of a run statement. A
+// single argument is run through a shell, unless it is a single word.
+func emitShlex(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt, args []*ast.Expr) (string, error) {
+	if len(args) == 1 {
+		commandStr, err := emitStringExpr(info, scope, call, args[0])
+		if err != nil {
+			return "", err
+		}
+
+		parts, err := shellquote.Split(commandStr)
+		if err != nil {
+			return "", err
+		}
+
+		if len(parts) == 1 {
+			return commandStr, nil
+		}
+		return shellquote.Join("/bin/sh", "-c", commandStr), nil
+	}
+
+	var runArgs []string
+	for _, arg := range args {
+		runArg, err := emitStringExpr(info, scope, call, arg)
+		if err != nil {
+			return "", err
+		}
+		runArgs = append(runArgs, runArg)
+	}
+	return shellquote.Join(runArgs...), nil
+}
+
 func emitOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*ast.Stmt, ac aliasCallback) ([]interface{}, error) {
+	if len(stmts) == 0 {
+		return nil, nil
+	}
+
+	typ := ast.ObjType(fmt.Sprintf("%s::%s", ast.Option, op))
+	for _, stmt := range stmts {
+		if stmt.Call == nil {
+			continue
+		}
+
+		err := checkNumArgs(typ, stmt.Call)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	switch op {
 	case "image":
 		return emitImageOptions(info, scope, op, stmts)
@@ -651,7 +802,7 @@ func emitOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*ast.St
 	case "copy":
 		return emitCopyOptions(info, scope, op, stmts)
 	default:
-		panic("call stmt does not support options")
+		return nil, ErrUnsupported{stmts[0], fmt.Sprintf("options for %s", op)}
 	}
 }
 
@@ -670,7 +821,7 @@ func emitImageOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*a
 					opts = append(opts, imagemetaresolver.WithDefault)
 				}
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -706,7 +857,7 @@ func emitHTTPOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*as
 				}
 				opts = append(opts, llb.Filename(filename))
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -732,7 +883,7 @@ func emitGitOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*ast
 					opts = append(opts, llb.KeepGitDir())
 				}
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -777,7 +928,7 @@ func emitLocalOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*a
 				}
 				opts = append(opts, llb.FollowPaths(paths))
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -815,7 +966,7 @@ func emitGenerateOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts [
 				}
 				opts = append(opts, llb.WithFrontendOpt(key, value))
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -857,7 +1008,7 @@ func emitMkdirOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*a
 
 				opts = append(opts, llb.WithCreatedTime(t))
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -893,7 +1044,7 @@ func emitMkfileOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*
 
 				opts = append(opts, llb.WithCreatedTime(t))
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -923,7 +1074,7 @@ func emitRmOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*ast.
 				}
 				opts = append(opts, llb.WithAllowWildcard(v))
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -997,7 +1148,7 @@ func emitCopyOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*as
 
 				opts = append(opts, llb.WithCreatedTime(t))
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -1067,10 +1218,10 @@ func emitExecOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*as
 					netMode = pb.NetMode_UNSET
 				case "host":
 					netMode = pb.NetMode_HOST
-				case "node":
+				case "none":
 					netMode = pb.NetMode_NONE
 				default:
-					panic("unknown network mode")
+					return opts, ErrUnsupported{args[0], fmt.Sprintf("network mode %q", mode)}
 				}
 
 				opts = append(opts, llb.Network(netMode))
@@ -1087,7 +1238,7 @@ func emitExecOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*as
 				case "insecure":
 					securityMode = pb.SecurityMode_INSECURE
 				default:
-					panic("unknown network mode")
+					return opts, ErrUnsupported{args[0], fmt.Sprintf("security mode %q", mode)}
 				}
 
 				opts = append(opts, llb.Security(securityMode))
@@ -1107,7 +1258,10 @@ func emitExecOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*as
 			case "ssh":
 				var sshOpts []llb.SSHOption
 				for _, iopt := range iopts {
-					opt := iopt.(llb.SSHOption)
+					opt, ok := iopt.(llb.SSHOption)
+					if !ok {
+						return opts, ErrWrongType{stmt.Call, "option::ssh", iopt}
+					}
 					sshOpts = append(sshOpts, opt)
 				}
 
@@ -1120,7 +1274,10 @@ func emitExecOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*as
 
 				var secretOpts []llb.SecretOption
 				for _, iopt := range iopts {
-					opt := iopt.(llb.SecretOption)
+					opt, ok := iopt.(llb.SecretOption)
+					if !ok {
+						return opts, ErrWrongType{stmt.Call, "option::secret", iopt}
+					}
 					secretOpts = append(secretOpts, opt)
 				}
 
@@ -1138,13 +1295,16 @@ func emitExecOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*as
 
 				var mountOpts []llb.MountOption
 				for _, iopt := range iopts {
-					opt := iopt.(llb.MountOption)
+					opt, ok := iopt.(llb.MountOption)
+					if !ok {
+						return opts, ErrWrongType{stmt.Call, "option::mount", iopt}
+					}
 					mountOpts = append(mountOpts, opt)
 				}
 
 				opts = append(opts, llb.AddMount(target, input, mountOpts...))
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -1212,7 +1372,7 @@ func emitSSHOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*ast
 				}
 				sopt.mode = os.FileMode(mode)
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -1280,7 +1440,7 @@ func emitSecretOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*
 				}
 				sopt.mode = os.FileMode(mode)
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
@@ -1348,12 +1508,12 @@ func emitMountOptions(info *CodeGenInfo, scope *ast.Scope, op string, stmts []*a
 				case "locked":
 					sharing = llb.CacheMountLocked
 				default:
-					panic("unknown sharing mode")
+					return opts, ErrUnsupported{args[1], fmt.Sprintf("cache sharing mode %q", mode)}
 				}
 
 				opts = append(opts, llb.AsPersistentCacheDir(id, sharing))
 			default:
-				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, ast.NewIdentExpr(stmt.Call.Func.Name))
+				iopts, err := emitOptionExpr(info, scope, stmt.Call, op, funcExpr(stmt.Call))
 				if err != nil {
 					return opts, err
 				}
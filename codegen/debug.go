@@ -9,18 +9,24 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path"
+	"sort"
 	"strings"
+	"time"
 	"unicode"
 
+	"github.com/alecthomas/participle/lexer"
 	shellquote "github.com/kballard/go-shellquote"
 	"github.com/logrusorgru/aurora"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
+	gateway "github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/solver/pb"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/openllb/hlb/ast"
 	"github.com/openllb/hlb/report"
 	"github.com/openllb/hlb/solver"
+	fstypes "github.com/tonistiigi/fsutil/types"
 )
 
 var (
@@ -41,7 +47,10 @@ type snapshot struct {
 	value interface{}
 }
 
-func NewDebugger(ctx context.Context, c *client.Client, w io.Writer, r *bufio.Reader, ibs map[string]*report.IndexedBuffer) Debugger {
+// NewDebugger returns a debugger that reads commands from r. Locals are the
+// local directories of the program being generated, which are shared with
+// codegen so the filesystem commands can solve states that depend on them.
+func NewDebugger(ctx context.Context, c *client.Client, w io.Writer, r *bufio.Reader, ibs map[string]*report.IndexedBuffer, locals map[string]string) Debugger {
 	color := aurora.NewAurora(true)
 
 	var (
@@ -184,6 +193,25 @@ func NewDebugger(ctx context.Context, c *client.Client, w io.Writer, r *bufio.Re
 
 						fmt.Fprintf(w, "%s\n", msg)
 					}
+				case "cat":
+					st, ok := s.value.(llb.State)
+					if !ok {
+						fmt.Fprintf(w, "current step is not in a fs scope\n")
+						continue
+					}
+
+					if len(args) != 2 {
+						fmt.Fprintf(w, "cat requires exactly one path\n")
+						continue
+					}
+
+					filename := debugPath(st, args[1])
+					err = solver.Build(ctx, c, []llb.State{st}, func(ctx context.Context, refs []gateway.Reference) error {
+						return printFile(ctx, w, refs[0], filename)
+					}, localSolveOpts(locals)...)
+					if err != nil {
+						fmt.Fprintf(w, "err: %s\n", err)
+					}
 				case "clear":
 					if len(args) == 0 {
 						breakpoints = append([]*Breakpoint{}, staticBreakpoints...)
@@ -194,6 +222,35 @@ func NewDebugger(ctx context.Context, c *client.Client, w io.Writer, r *bufio.Re
 				case "continue", "c":
 					cont = true
 					return nil
+				case "diff":
+					st, ok := s.value.(llb.State)
+					if !ok {
+						fmt.Fprintf(w, "current step is not in a fs scope\n")
+						continue
+					}
+
+					contents := len(args) == 3 && args[1] == "-c"
+					if contents {
+						args = append(args[:1], args[2:]...)
+					}
+
+					if len(args) != 2 {
+						fmt.Fprintf(w, "diff requires exactly one alias\n")
+						continue
+					}
+
+					other, err := debugFilesystem(s.scope, args[1], locals)
+					if err != nil {
+						fmt.Fprintf(w, "err: %s\n", err)
+						continue
+					}
+
+					err = solver.Build(ctx, c, []llb.State{other, st}, func(ctx context.Context, refs []gateway.Reference) error {
+						return printDiff(ctx, w, refs[0], refs[1], contents)
+					}, localSolveOpts(locals)...)
+					if err != nil {
+						fmt.Fprintf(w, "err: %s\n", err)
+					}
 				case "dir":
 					st, ok := s.value.(llb.State)
 					if !ok {
@@ -243,7 +300,8 @@ func NewDebugger(ctx context.Context, c *client.Client, w io.Writer, r *bufio.Re
 					wc := &nopWriteCloser{buf}
 
 					ref := "hlb-exec"
-					err = solver.Solve(ctx, c, st, solver.WithDownloadDockerTarball(ref, wc))
+					solveOpts := append(localSolveOpts(locals), solver.WithDownloadDockerTarball(ref, wc))
+					err = solver.Solve(ctx, c, st, solveOpts...)
 					if err != nil {
 						fmt.Fprintf(w, "err: %s\n", err)
 						continue
@@ -291,6 +349,10 @@ func NewDebugger(ctx context.Context, c *client.Client, w io.Writer, r *bufio.Re
 					fmt.Fprintf(w, "env - print environment\n")
 					fmt.Fprintf(w, "network - print network mode\n")
 					fmt.Fprintf(w, "security - print security mode\n")
+					fmt.Fprintf(w, "ls [ <path> ] - list directory contents\n")
+					fmt.Fprintf(w, "cat <path> - print file contents\n")
+					fmt.Fprintf(w, "stat <path> - print file status\n")
+					fmt.Fprintf(w, "diff [ -c ] <alias> - print files changed since an aliased fs, comparing contents with -c\n")
 				case "list", "l":
 					if showList {
 						err = printList(color, ibs, w, s.node)
@@ -308,6 +370,25 @@ func NewDebugger(ctx context.Context, c *client.Client, w io.Writer, r *bufio.Re
 							fmt.Fprintf(w, "%s %s = %#v\n", arg.Type, arg.Name, data)
 						}
 					}
+				case "ls":
+					st, ok := s.value.(llb.State)
+					if !ok {
+						fmt.Fprintf(w, "current step is not in a fs scope\n")
+						continue
+					}
+
+					dir := "."
+					if len(args) == 2 {
+						dir = args[1]
+					}
+					dir = debugPath(st, dir)
+
+					err = solver.Build(ctx, c, []llb.State{st}, func(ctx context.Context, refs []gateway.Reference) error {
+						return printDir(ctx, w, refs[0], dir)
+					}, localSolveOpts(locals)...)
+					if err != nil {
+						fmt.Fprintf(w, "err: %s\n", err)
+					}
 				case "next", "n":
 					next = fun
 					return nil
@@ -340,6 +421,25 @@ func NewDebugger(ctx context.Context, c *client.Client, w io.Writer, r *bufio.Re
 					}
 
 					fmt.Fprintf(w, "Security %s\n", st.GetSecurity())
+				case "stat":
+					st, ok := s.value.(llb.State)
+					if !ok {
+						fmt.Fprintf(w, "current step is not in a fs scope\n")
+						continue
+					}
+
+					if len(args) != 2 {
+						fmt.Fprintf(w, "stat requires exactly one path\n")
+						continue
+					}
+
+					filename := debugPath(st, args[1])
+					err = solver.Build(ctx, c, []llb.State{st}, func(ctx context.Context, refs []gateway.Reference) error {
+						return printFileStat(ctx, w, refs[0], filename)
+					}, localSolveOpts(locals)...)
+					if err != nil {
+						fmt.Fprintf(w, "err: %s\n", err)
+					}
 				case "step", "s":
 					return nil
 				case "stepout":
@@ -387,8 +487,24 @@ func NewDebugger(ctx context.Context, c *client.Client, w io.Writer, r *bufio.Re
 }
 
 func printList(color aurora.Aurora, ibs map[string]*report.IndexedBuffer, w io.Writer, node ast.Node) error {
-	pos := node.Position()
-	ib := ibs[pos.Filename]
+	length := 1
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		length = n.Name.End().Column - n.Pos.Column
+	case *ast.CallStmt:
+		length = n.Func.End().Column - n.Pos.Column
+	}
+
+	return printListAt(color, ibs, w, node.Position(), length)
+}
+
+// printListAt prints the source code surrounding pos, underlining length
+// characters from pos.
+func printListAt(color aurora.Aurora, ibs map[string]*report.IndexedBuffer, w io.Writer, pos lexer.Position, length int) error {
+	ib, ok := ibs[pos.Filename]
+	if !ok {
+		return fmt.Errorf("no source for %s", pos.Filename)
+	}
 
 	var lines []string
 
@@ -402,14 +518,6 @@ func printList(color aurora.Aurora, ibs map[string]*report.IndexedBuffer, w io.W
 		end = ib.Len()
 	}
 
-	length := 1
-	switch n := node.(type) {
-	case *ast.FuncDecl:
-		length = n.Name.End().Column - n.Pos.Column
-	case *ast.CallStmt:
-		length = n.Func.End().Column - n.Pos.Column
-	}
-
 	maxLn := len(fmt.Sprintf("%d", end))
 	gutter := strings.Repeat(" ", maxLn)
 	header := fmt.Sprintf(
@@ -449,6 +557,253 @@ func printList(color aurora.Aurora, ibs map[string]*report.IndexedBuffer, w io.W
 	return nil
 }
 
+// debugPath resolves a path relative to the working directory of a state.
+func debugPath(st llb.State, p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join("/", st.GetDir(), p)
+}
+
+// localSolveOpts returns the solve options that make locals available to a
+// solve.
+func localSolveOpts(locals map[string]string) []solver.SolveOption {
+	var opts []solver.SolveOption
+	for id, path := range locals {
+		opts = append(opts, solver.WithLocal(id, path))
+	}
+	return opts
+}
+
+// debugFilesystem resolves a symbol in scope to the fs it represents. Aliases
+// and functions are generated without the debugger so they can be inspected
+// from any step. Locals they depend on are added to locals.
+func debugFilesystem(scope *ast.Scope, name string, locals map[string]string) (llb.State, error) {
+	st := llb.Scratch()
+
+	obj := scope.Lookup(name)
+	if obj == nil {
+		return st, fmt.Errorf("%s is not defined", name)
+	}
+
+	switch obj.Kind {
+	case ast.ExprKind:
+		st, ok := obj.Data.(llb.State)
+		if !ok {
+			return st, fmt.Errorf("%s is not a fs", name)
+		}
+		return st, nil
+	case ast.DeclKind:
+		info := &CodeGenInfo{
+			Debug:  NewNoopDebugger(),
+			Locals: locals,
+		}
+
+		switch n := obj.Node.(type) {
+		case *ast.FuncDecl:
+			if n.Type.Type() != ast.Filesystem {
+				return st, fmt.Errorf("%s is not a fs", name)
+			}
+			if n.Params.NumFields() > 0 {
+				return st, fmt.Errorf("%s must not have arguments", name)
+			}
+			return emitFilesystemFuncDecl(info, scope, n, nil, noopAliasCallback)
+		case *ast.AliasDecl:
+			if n.Func.Type.Type() != ast.Filesystem {
+				return st, fmt.Errorf("%s is not a fs", name)
+			}
+			if n.Func.Params.NumFields() > 0 {
+				return st, fmt.Errorf("%s must not have arguments", name)
+			}
+			return emitFilesystemAliasDecl(info, scope, n, nil)
+		}
+	}
+
+	return st, fmt.Errorf("%s is not a fs", name)
+}
+
+// printDir prints the contents of a directory in ref.
+func printDir(ctx context.Context, w io.Writer, ref gateway.Reference, dir string) error {
+	if ref == nil {
+		return nil
+	}
+
+	stats, err := ref.ReadDir(ctx, gateway.ReadDirRequest{
+		Path: dir,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, stat := range stats {
+		fmt.Fprintf(w, "%s %5d %5d %10d %s\n",
+			os.FileMode(stat.Mode),
+			stat.Uid,
+			stat.Gid,
+			stat.Size_,
+			stat.Path)
+	}
+	return nil
+}
+
+// printFile prints the contents of a file in ref.
+func printFile(ctx context.Context, w io.Writer, ref gateway.Reference, filename string) error {
+	if ref == nil {
+		return fmt.Errorf("%s: no such file or directory", filename)
+	}
+
+	dt, err := ref.ReadFile(ctx, gateway.ReadRequest{
+		Filename: filename,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(dt)
+	return err
+}
+
+// printFileStat prints the status of a file in ref.
+func printFileStat(ctx context.Context, w io.Writer, ref gateway.Reference, filename string) error {
+	if ref == nil {
+		return fmt.Errorf("%s: no such file or directory", filename)
+	}
+
+	stat, err := ref.StatFile(ctx, gateway.StatRequest{
+		Path: filename,
+	})
+	if err != nil {
+		return err
+	}
+
+	printStat(w, filename, stat)
+	return nil
+}
+
+func printStat(w io.Writer, filename string, stat *fstypes.Stat) {
+	fmt.Fprintf(w, "  File: %s\n", filename)
+	if stat.Linkname != "" {
+		fmt.Fprintf(w, "  Link: %s\n", stat.Linkname)
+	}
+	fmt.Fprintf(w, "  Size: %d\n", stat.Size_)
+	fmt.Fprintf(w, "  Mode: %s\n", os.FileMode(stat.Mode))
+	fmt.Fprintf(w, "   Uid: %d\n", stat.Uid)
+	fmt.Fprintf(w, "   Gid: %d\n", stat.Gid)
+	fmt.Fprintf(w, "Modify: %s\n", time.Unix(0, stat.ModTime).UTC())
+}
+
+// printDiff prints the files added, deleted or modified in ref compared to
+// base. Files are compared by their metadata, and only if contents is set are
+// regular files with the same metadata read to compare their contents.
+func printDiff(ctx context.Context, w io.Writer, base, ref gateway.Reference, contents bool) error {
+	baseStats, err := walkReference(ctx, base)
+	if err != nil {
+		return err
+	}
+
+	stats, err := walkReference(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	changes := make(map[string]string)
+	for p, stat := range stats {
+		baseStat, ok := baseStats[p]
+		if !ok {
+			changes[p] = "A"
+			continue
+		}
+
+		if isStatModified(baseStat, stat) {
+			changes[p] = "M"
+			continue
+		}
+
+		if contents && os.FileMode(stat.Mode).IsRegular() {
+			modified, err := isContentModified(ctx, base, ref, p)
+			if err != nil {
+				return err
+			}
+			if modified {
+				changes[p] = "M"
+			}
+		}
+	}
+	for p := range baseStats {
+		if _, ok := stats[p]; !ok {
+			changes[p] = "D"
+		}
+	}
+
+	var paths []string
+	for p := range changes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		fmt.Fprintf(w, "%s %s\n", changes[p], p)
+	}
+	return nil
+}
+
+func isStatModified(baseStat, stat *fstypes.Stat) bool {
+	return baseStat.Mode != stat.Mode ||
+		baseStat.Uid != stat.Uid ||
+		baseStat.Gid != stat.Gid ||
+		baseStat.Size_ != stat.Size_ ||
+		baseStat.Linkname != stat.Linkname ||
+		baseStat.ModTime != stat.ModTime
+}
+
+func isContentModified(ctx context.Context, base, ref gateway.Reference, p string) (bool, error) {
+	baseDt, err := base.ReadFile(ctx, gateway.ReadRequest{Filename: p})
+	if err != nil {
+		return false, err
+	}
+
+	dt, err := ref.ReadFile(ctx, gateway.ReadRequest{Filename: p})
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(baseDt, dt), nil
+}
+
+// walkReference returns the stat of every file in a reference keyed by its
+// absolute path.
+func walkReference(ctx context.Context, ref gateway.Reference) (map[string]*fstypes.Stat, error) {
+	stats := make(map[string]*fstypes.Stat)
+	if ref == nil {
+		return stats, nil
+	}
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := ref.ReadDir(ctx, gateway.ReadDirRequest{
+			Path: dir,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, stat := range entries {
+			p := path.Join(dir, stat.Path)
+			stats[p] = stat
+
+			if os.FileMode(stat.Mode).IsDir() {
+				err = walk(p)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	return stats, walk("/")
+}
+
 type Breakpoint struct {
 	Func *ast.FuncDecl
 	Call *ast.CallStmt
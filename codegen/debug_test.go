@@ -0,0 +1,185 @@
+package codegen
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	gateway "github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+	fstypes "github.com/tonistiigi/fsutil/types"
+)
+
+type testFile struct {
+	mode    os.FileMode
+	content string
+	modTime int64
+}
+
+// testReference is a gateway reference to an in-memory filesystem keyed by
+// absolute path.
+type testReference struct {
+	files map[string]testFile
+	reads int
+}
+
+func (r *testReference) ToState() (llb.State, error) {
+	return llb.Scratch(), nil
+}
+
+func (r *testReference) ReadFile(ctx context.Context, req gateway.ReadRequest) ([]byte, error) {
+	f, ok := r.files[req.Filename]
+	if !ok || f.mode.IsDir() {
+		return nil, os.ErrNotExist
+	}
+	r.reads++
+	return []byte(f.content), nil
+}
+
+func (r *testReference) StatFile(ctx context.Context, req gateway.StatRequest) (*fstypes.Stat, error) {
+	f, ok := r.files[req.Path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return r.stat(req.Path, f), nil
+}
+
+func (r *testReference) ReadDir(ctx context.Context, req gateway.ReadDirRequest) ([]*fstypes.Stat, error) {
+	var stats []*fstypes.Stat
+	for p, f := range r.files {
+		if p != "/" && path.Dir(p) == req.Path {
+			stats = append(stats, r.stat(path.Base(p), f))
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Path < stats[j].Path
+	})
+	return stats, nil
+}
+
+func (r *testReference) stat(p string, f testFile) *fstypes.Stat {
+	return &fstypes.Stat{
+		Path:    p,
+		Mode:    uint32(f.mode),
+		Size_:   int64(len(f.content)),
+		ModTime: f.modTime,
+	}
+}
+
+func newTestReference(files map[string]testFile) *testReference {
+	files["/"] = testFile{mode: os.ModeDir | 0755}
+	return &testReference{files: files}
+}
+
+func TestDebugFilesystemCommands(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ref := newTestReference(map[string]testFile{
+		"/etc":          {mode: os.ModeDir | 0755},
+		"/etc/hostname": {mode: 0644, content: "hlb\n"},
+	})
+
+	var buf bytes.Buffer
+	err := printDir(ctx, &buf, ref, "/etc")
+	require.NoError(t, err)
+	require.Equal(t, "-rw-r--r--     0     0          4 hostname\n", buf.String())
+
+	buf.Reset()
+	err = printFile(ctx, &buf, ref, "/etc/hostname")
+	require.NoError(t, err)
+	require.Equal(t, "hlb\n", buf.String())
+
+	buf.Reset()
+	err = printFileStat(ctx, &buf, ref, "/etc/hostname")
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "  File: /etc/hostname\n")
+	require.Contains(t, buf.String(), "  Size: 4\n")
+	require.Contains(t, buf.String(), "  Mode: -rw-r--r--\n")
+
+	err = printFile(ctx, &buf, nil, "/etc/hostname")
+	require.EqualError(t, err, "/etc/hostname: no such file or directory")
+}
+
+func TestPrintDiff(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	base := newTestReference(map[string]testFile{
+		"/deleted":   {mode: 0644, content: "a"},
+		"/chmod":     {mode: 0644, content: "a"},
+		"/touched":   {mode: 0644, content: "a", modTime: 1},
+		"/rewritten": {mode: 0644, content: "a"},
+		"/same":      {mode: 0644, content: "a"},
+	})
+	ref := newTestReference(map[string]testFile{
+		"/added":     {mode: 0644, content: "a"},
+		"/chmod":     {mode: 0755, content: "a"},
+		"/touched":   {mode: 0644, content: "a", modTime: 2},
+		"/rewritten": {mode: 0644, content: "b"},
+		"/same":      {mode: 0644, content: "a"},
+	})
+
+	var buf bytes.Buffer
+	err := printDiff(ctx, &buf, base, ref, false)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"A /added",
+		"M /chmod",
+		"D /deleted",
+		"M /touched",
+	}, "\n")+"\n", buf.String())
+	require.Zero(t, base.reads)
+	require.Zero(t, ref.reads)
+
+	buf.Reset()
+	err = printDiff(ctx, &buf, base, ref, true)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"A /added",
+		"M /chmod",
+		"D /deleted",
+		"M /rewritten",
+		"M /touched",
+	}, "\n")+"\n", buf.String())
+	require.Equal(t, 2, base.reads)
+	require.Equal(t, 2, ref.reads)
+}
+
+func TestDebugFilesystemLocals(t *testing.T) {
+	t.Parallel()
+
+	file := &ast.File{
+		Decls: []*ast.Decl{{
+			Func: &ast.FuncDecl{
+				Type:   ast.NewType(ast.Filesystem),
+				Name:   ast.NewIdent("src"),
+				Params: &ast.FieldList{},
+				Body: &ast.BlockStmt{List: []*ast.Stmt{
+					ast.NewCallStmt("local", []*ast.Expr{ast.NewStringExpr(".")}, nil, nil),
+				}},
+			},
+		}},
+	}
+
+	root, err := report.SemanticCheck(file)
+	require.NoError(t, err)
+
+	locals := make(map[string]string)
+	_, err = debugFilesystem(root.Scope, "src", locals)
+	require.NoError(t, err)
+	require.Len(t, locals, 1)
+	for _, p := range locals {
+		require.Equal(t, ".", p)
+	}
+
+	_, err = debugFilesystem(root.Scope, "missing", locals)
+	require.EqualError(t, err, "missing is not defined")
+}
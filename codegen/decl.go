@@ -14,9 +14,34 @@ func emitFuncDecl(info *CodeGenInfo, scope *ast.Scope, fun *ast.FuncDecl, call *
 		args = call.Args
 	}
 
-	if len(args) != len(fun.Params.List) {
-		return nil, fmt.Errorf("%s expected args %s, found %s", fun.Name, fun.Params.List, args)
+	if len(args) != fun.Params.NumFields() {
+		if call == nil {
+			return nil, report.ErrFuncArg{Ident: fun.Name}
+		}
+		return nil, report.ErrNumArgs{Expected: fun.Params.NumFields(), CallStmt: call}
+	}
+
+	// Functions that were never semantically checked have no scope of their
+	// own yet.
+	if fun.Scope == nil {
+		fun.Scope = ast.NewScope(fun, scope)
+	}
+
+	// Calls that recurse into themselves never terminate, which includes
+	// args that evaluate the call they are passed to.
+	key := emitKey{fun, call}
+	if _, ok := info.emitting[key]; ok {
+		var node ast.Node = fun.Name
+		if call != nil {
+			node = call
+		}
+		return nil, ErrUnsupported{node, fmt.Sprintf("recursive call to %s", fun.Name)}
+	}
+	if info.emitting == nil {
+		info.emitting = make(map[emitKey]struct{})
 	}
+	info.emitting[key] = struct{}{}
+	defer delete(info.emitting, key)
 
 	err := parameterizedScope(info, scope, call, op, fun, args, ac)
 	if err != nil {
@@ -56,7 +81,12 @@ func emitFilesystemFuncDecl(info *CodeGenInfo, scope *ast.Scope, fun *ast.FuncDe
 	if err != nil {
 		return llb.Scratch(), err
 	}
-	return v.(llb.State), nil
+
+	st, ok := v.(llb.State)
+	if !ok {
+		return llb.Scratch(), ErrWrongType{fun.Name, string(ast.Filesystem), v}
+	}
+	return st, nil
 }
 
 func emitOptionFuncDecl(info *CodeGenInfo, scope *ast.Scope, fun *ast.FuncDecl, call *ast.CallStmt, op string) ([]interface{}, error) {
@@ -64,7 +94,12 @@ func emitOptionFuncDecl(info *CodeGenInfo, scope *ast.Scope, fun *ast.FuncDecl,
 	if err != nil {
 		return nil, err
 	}
-	return v.([]interface{}), nil
+
+	iopts, ok := v.([]interface{})
+	if !ok {
+		return nil, ErrWrongType{fun.Name, string(ast.Option), v}
+	}
+	return iopts, nil
 }
 
 func emitStringFuncDecl(info *CodeGenInfo, scope *ast.Scope, fun *ast.FuncDecl, call *ast.CallStmt, ac aliasCallback) (string, error) {
@@ -72,7 +107,12 @@ func emitStringFuncDecl(info *CodeGenInfo, scope *ast.Scope, fun *ast.FuncDecl,
 	if err != nil {
 		return "", err
 	}
-	return v.(string), nil
+
+	str, ok := v.(string)
+	if !ok {
+		return "", ErrWrongType{fun.Name, string(ast.Str), v}
+	}
+	return str, nil
 }
 
 func emitAliasDecl(info *CodeGenInfo, scope *ast.Scope, alias *ast.AliasDecl, call *ast.CallStmt) (interface{}, error) {
@@ -94,7 +134,12 @@ func emitFilesystemAliasDecl(info *CodeGenInfo, scope *ast.Scope, alias *ast.Ali
 	if err != nil {
 		return llb.Scratch(), err
 	}
-	return v.(llb.State), nil
+
+	st, ok := v.(llb.State)
+	if !ok {
+		return llb.Scratch(), ErrWrongType{alias, string(ast.Filesystem), v}
+	}
+	return st, nil
 }
 
 func emitStringAliasDecl(info *CodeGenInfo, scope *ast.Scope, alias *ast.AliasDecl, call *ast.CallStmt) (string, error) {
@@ -102,10 +147,19 @@ func emitStringAliasDecl(info *CodeGenInfo, scope *ast.Scope, alias *ast.AliasDe
 	if err != nil {
 		return "", err
 	}
-	return v.(string), nil
+
+	str, ok := v.(string)
+	if !ok {
+		return "", ErrWrongType{alias, string(ast.Str), v}
+	}
+	return str, nil
 }
 
 func parameterizedScope(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt, op string, fun *ast.FuncDecl, args []*ast.Expr, ac aliasCallback) error {
+	if fun.Params == nil {
+		return nil
+	}
+
 	for i, field := range fun.Params.List {
 		var (
 			data interface{}
@@ -131,6 +185,12 @@ func parameterizedScope(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt,
 			v, err = emitFilesystemExpr(info, scope, nil, args[i], ac)
 			data = v
 		case ast.Option:
+			// Options of a typed param are for the call its subtype names.
+			op := op
+			if subtype := field.Type.SubType(); subtype != ast.None {
+				op = string(subtype)
+			}
+
 			var v []interface{}
 			v, err = emitOptionExpr(info, scope, call, op, args[i])
 			data = v
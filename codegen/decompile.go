@@ -0,0 +1,748 @@
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	shellquote "github.com/kballard/go-shellquote"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+)
+
+const (
+	// defaultPathEnv is the PATH that execs are given if their state has
+	// none, so it isn't decompiled as an env option.
+	defaultPathEnv = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+	defaultSecretMode = 0400
+	defaultSSHMode    = 0600
+)
+
+// vertex is an output of an op in a LLB definition.
+type vertex struct {
+	dgst  digest.Digest
+	index pb.OutputIndex
+}
+
+// Decompile reconstructs a HLB program from a LLB definition. The vertex that
+// the definition solves becomes the default function, and vertices used more
+// than once become functions of their own so that shared subgraphs are only
+// written once. Sources, execs and file actions are mapped back to the
+// builtins that emit them, and the mounts of an exec are kept as options of
+// run. Mounts whose output is used by other vertices are aliased.
+//
+// Locals are decompiled by the name of their session, which for definitions
+// compiled by HLB is a digest of their path and options.
+func Decompile(def *llb.Definition) (*ast.File, error) {
+	ops, err := loadLLB(def)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decompiler{
+		ops:     make(map[digest.Digest]*pb.Op),
+		uses:    make(map[vertex]int),
+		forced:  make(map[vertex]bool),
+		funcs:   make(map[vertex]string),
+		aliases: make(map[vertex]string),
+		names:   ast.NewNames(report.Keywords, report.ReservedKeywords),
+	}
+
+	var target *vertex
+	for i := range ops {
+		op := ops[i].Op
+		d.ops[ops[i].Digest] = &op
+
+		// The last op of a definition only points at the vertex it solves.
+		if op.Op == nil && len(op.Inputs) > 0 {
+			target = &vertex{op.Inputs[0].Digest, op.Inputs[0].Index}
+		}
+	}
+
+	if target == nil {
+		file := &ast.File{}
+		file.Decls = append(file.Decls, &ast.Decl{
+			Func: newFuncDecl("default", ast.NewCallStmt("scratch", nil, nil, nil)),
+		})
+		return file, nil
+	}
+
+	visited := make(map[digest.Digest]struct{})
+	err = d.count(target.dgst, visited)
+	if err != nil {
+		return nil, err
+	}
+
+	// Aliases are declared in the function that runs their exec, so execs
+	// with used mounts must be functions.
+	for dgst := range visited {
+		exec, ok := d.ops[dgst].Op.(*pb.Op_Exec)
+		if !ok {
+			continue
+		}
+
+		root := rootMount(exec.Exec)
+		for _, mount := range exec.Exec.Mounts {
+			if root != nil && mount != root && mount.Output != pb.SkipOutput && d.uses[vertex{dgst, mount.Output}] > 0 {
+				d.forced[vertex{dgst, root.Output}] = true
+			}
+		}
+	}
+
+	d.names.Reserve("default")
+	err = d.declare(*target, "default")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.File{Decls: d.decls}, nil
+}
+
+type decompiler struct {
+	ops map[digest.Digest]*pb.Op
+
+	// uses is the number of times a vertex is an input of another vertex.
+	uses map[vertex]int
+
+	// forced are the vertices that must be functions even if they are used
+	// only once, which are execs with aliased mounts.
+	forced map[vertex]bool
+
+	funcs   map[vertex]string
+	aliases map[vertex]string
+	names   ast.Names
+	decls   []*ast.Decl
+}
+
+// count counts the uses of every vertex reachable from an op.
+func (d *decompiler) count(dgst digest.Digest, visited map[digest.Digest]struct{}) error {
+	if _, ok := visited[dgst]; ok {
+		return nil
+	}
+	visited[dgst] = struct{}{}
+
+	op, ok := d.ops[dgst]
+	if !ok {
+		return fmt.Errorf("definition is missing op %s", dgst)
+	}
+
+	use := func(i pb.InputIndex) {
+		if i >= 0 && int(i) < len(op.Inputs) {
+			d.uses[vertex{op.Inputs[i].Digest, op.Inputs[i].Index}]++
+		}
+	}
+
+	switch o := op.Op.(type) {
+	case *pb.Op_Exec:
+		for _, mount := range o.Exec.Mounts {
+			use(mount.Input)
+		}
+	case *pb.Op_File:
+		for _, action := range o.File.Actions {
+			use(action.Input)
+			use(action.SecondaryInput)
+		}
+	default:
+		for i := range op.Inputs {
+			use(pb.InputIndex(i))
+		}
+	}
+
+	for _, input := range op.Inputs {
+		err := d.count(input.Digest, visited)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declare declares a function that returns a vertex.
+func (d *decompiler) declare(v vertex, name string) error {
+	d.funcs[v] = name
+
+	stmts, err := d.chain(v)
+	if err != nil {
+		return err
+	}
+
+	d.decls = append(d.decls, &ast.Decl{Func: newFuncDecl(name, stmts...)})
+	return nil
+}
+
+// ref returns the statements of a vertex used as an input, which is a call if
+// the vertex is a function. Mounts are always called by their alias.
+func (d *decompiler) ref(v vertex) ([]*ast.Stmt, error) {
+	if (d.uses[v] <= 1 && !d.forced[v]) || d.isMount(v) {
+		return d.chain(v)
+	}
+
+	name, ok := d.funcs[v]
+	if !ok {
+		name = d.names.Unique(d.vertexName(v))
+		err := d.declare(v, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []*ast.Stmt{ast.NewCallStmt(name, nil, nil, nil)}, nil
+}
+
+// refExpr returns a fs block literal of a vertex used as an input.
+func (d *decompiler) refExpr(op *pb.Op, i pb.InputIndex) (*ast.Expr, error) {
+	if i == pb.Empty {
+		return ast.NewBlockLitExpr(ast.Filesystem, ast.NewCallStmt("scratch", nil, nil, nil)), nil
+	}
+
+	v, err := inputVertex(op, i)
+	if err != nil {
+		return nil, err
+	}
+
+	stmts, err := d.ref(v)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewBlockLitExpr(ast.Filesystem, stmts...), nil
+}
+
+// inputVertex returns the vertex of an input of an op.
+func inputVertex(op *pb.Op, i pb.InputIndex) (vertex, error) {
+	if i < 0 || int(i) >= len(op.Inputs) {
+		return vertex{}, fmt.Errorf("op is missing input %d", i)
+	}
+	return vertex{op.Inputs[i].Digest, op.Inputs[i].Index}, nil
+}
+
+// chain returns the statements that build a vertex.
+func (d *decompiler) chain(v vertex) ([]*ast.Stmt, error) {
+	op, ok := d.ops[v.dgst]
+	if !ok {
+		return nil, fmt.Errorf("definition is missing op %s", v.dgst)
+	}
+
+	switch o := op.Op.(type) {
+	case *pb.Op_Source:
+		return decompileSource(o.Source), nil
+	case *pb.Op_Exec:
+		root := rootMount(o.Exec)
+		if root == nil {
+			return nil, fmt.Errorf("exec %s has no root mount", v.dgst)
+		}
+
+		// Mounts other than the root are only reachable through the alias
+		// declared in the function that runs the exec.
+		if v.index != root.Output {
+			_, err := d.ref(vertex{v.dgst, root.Output})
+			if err != nil {
+				return nil, err
+			}
+			return []*ast.Stmt{ast.NewCallStmt(d.alias(v, ""), nil, nil, nil)}, nil
+		}
+
+		var stmts []*ast.Stmt
+		if root.Input == pb.Empty {
+			stmts = append(stmts, ast.NewCallStmt("scratch", nil, nil, nil))
+		} else {
+			input, err := inputVertex(op, root.Input)
+			if err != nil {
+				return nil, err
+			}
+
+			stmts, err = d.ref(input)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		run, err := d.decompileExec(v.dgst, op, o.Exec, root)
+		if err != nil {
+			return nil, err
+		}
+		return append(stmts, run), nil
+	case *pb.Op_File:
+		for i, action := range o.File.Actions {
+			if action.Output == v.index {
+				return d.decompileAction(op, o.File, i)
+			}
+		}
+		return nil, fmt.Errorf("file op %s has no output %d", v.dgst, v.index)
+	default:
+		return []*ast.Stmt{
+			ast.NewCallStmt("scratch", nil, nil, nil),
+			ast.NewCommentStmt(fmt.Sprintf("%T %s cannot be decompiled", op.Op, v.dgst)),
+		}, nil
+	}
+}
+
+func decompileSource(src *pb.SourceOp) []*ast.Stmt {
+	var (
+		scheme string
+		id     = src.Identifier
+	)
+	if i := strings.Index(id, "://"); i >= 0 {
+		scheme, id = id[:i], id[i+3:]
+	}
+
+	var opts []*ast.Stmt
+	switch scheme {
+	case "docker-image":
+		return []*ast.Stmt{ast.NewCallStmt("image", ast.NewStringExprs(familiarRef(id)), nil, nil)}
+	case "git":
+		remote, ref := id, ""
+		if i := strings.LastIndex(id, "#"); i >= 0 {
+			remote, ref = id[:i], id[i+1:]
+		}
+		if url, ok := src.Attrs[pb.AttrFullRemoteURL]; ok {
+			remote = url
+		}
+
+		if src.Attrs[pb.AttrKeepGitDir] == "true" {
+			opts = append(opts, ast.NewCallStmt("keepGitDir", nil, nil, nil))
+		}
+		return []*ast.Stmt{ast.NewCallStmt("git", ast.NewStringExprs(remote, ref), newWithOpt(opts), nil)}
+	case "local":
+		for _, attr := range []struct {
+			key, name string
+		}{
+			{pb.AttrIncludePatterns, "includePatterns"},
+			{pb.AttrExcludePatterns, "excludePatterns"},
+			{pb.AttrFollowPaths, "followPaths"},
+		} {
+			var patterns []string
+			if err := json.Unmarshal([]byte(src.Attrs[attr.key]), &patterns); err == nil && len(patterns) > 0 {
+				opts = append(opts, ast.NewCallStmt(attr.name, ast.NewStringExprs(patterns...), nil, nil))
+			}
+		}
+		return []*ast.Stmt{ast.NewCallStmt("local", ast.NewStringExprs(id), newWithOpt(opts), nil)}
+	case "http", "https":
+		if dgst, ok := src.Attrs[pb.AttrHTTPChecksum]; ok {
+			opts = append(opts, ast.NewCallStmt("checksum", ast.NewStringExprs(dgst), nil, nil))
+		}
+		if perm, err := strconv.ParseInt(src.Attrs[pb.AttrHTTPPerm], 8, 64); err == nil {
+			opts = append(opts, ast.NewCallStmt("chmod", []*ast.Expr{ast.NewNumericExpr(perm, 8)}, nil, nil))
+		}
+		if filename, ok := src.Attrs[pb.AttrHTTPFilename]; ok {
+			opts = append(opts, ast.NewCallStmt("filename", ast.NewStringExprs(filename), nil, nil))
+		}
+		return []*ast.Stmt{ast.NewCallStmt("http", ast.NewStringExprs(src.Identifier), newWithOpt(opts), nil)}
+	default:
+		return []*ast.Stmt{
+			ast.NewCallStmt("scratch", nil, nil, nil),
+			ast.NewCommentStmt(fmt.Sprintf("source %s cannot be decompiled", src.Identifier)),
+		}
+	}
+}
+
+func (d *decompiler) decompileExec(dgst digest.Digest, op *pb.Op, exec *pb.ExecOp, root *pb.Mount) (*ast.Stmt, error) {
+	meta := exec.Meta
+
+	var opts []*ast.Stmt
+	if root.Readonly {
+		opts = append(opts, ast.NewCallStmt("readonlyRootfs", nil, nil, nil))
+	}
+	for _, env := range meta.Env {
+		if env == defaultPathEnv {
+			continue
+		}
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) != 2 {
+			kv = append(kv, "")
+		}
+		opts = append(opts, ast.NewCallStmt("env", ast.NewStringExprs(kv...), nil, nil))
+	}
+	if meta.Cwd != "" && meta.Cwd != "/" {
+		opts = append(opts, ast.NewCallStmt("dir", ast.NewStringExprs(meta.Cwd), nil, nil))
+	}
+	if meta.User != "" {
+		opts = append(opts, ast.NewCallStmt("user", ast.NewStringExprs(meta.User), nil, nil))
+	}
+	switch exec.Network {
+	case pb.NetMode_HOST:
+		opts = append(opts, ast.NewCallStmt("network", ast.NewStringExprs("host"), nil, nil))
+	case pb.NetMode_NONE:
+		opts = append(opts, ast.NewCallStmt("network", ast.NewStringExprs("none"), nil, nil))
+	}
+	if exec.Security == pb.SecurityMode_INSECURE {
+		opts = append(opts, ast.NewCallStmt("security", ast.NewStringExprs("insecure"), nil, nil))
+	}
+	for _, host := range meta.ExtraHosts {
+		opts = append(opts, ast.NewCallStmt("host", ast.NewStringExprs(host.Host, host.IP), nil, nil))
+	}
+
+	for _, mount := range exec.Mounts {
+		if mount == root {
+			continue
+		}
+
+		switch mount.MountType {
+		case pb.MountType_SECRET:
+			opts = append(opts, decompileSecret(mount))
+			continue
+		case pb.MountType_SSH:
+			opts = append(opts, decompileSSH(mount))
+			continue
+		}
+
+		input, err := d.refExpr(op, mount.Input)
+		if err != nil {
+			return nil, err
+		}
+
+		var mountOpts []*ast.Stmt
+		if mount.Readonly {
+			mountOpts = append(mountOpts, ast.NewCallStmt("readonly", nil, nil, nil))
+		}
+		if mount.Selector != "" {
+			mountOpts = append(mountOpts, ast.NewCallStmt("sourcePath", ast.NewStringExprs(mount.Selector), nil, nil))
+		}
+		switch mount.MountType {
+		case pb.MountType_CACHE:
+			if mount.CacheOpt == nil {
+				break
+			}
+
+			sharing := "shared"
+			switch mount.CacheOpt.Sharing {
+			case pb.CacheSharingOpt_PRIVATE:
+				sharing = "private"
+			case pb.CacheSharingOpt_LOCKED:
+				sharing = "locked"
+			}
+			mountOpts = append(mountOpts, ast.NewCallStmt("cache", ast.NewStringExprs(mount.CacheOpt.ID, sharing), nil, nil))
+		case pb.MountType_TMPFS:
+			mountOpts = append(mountOpts, ast.NewCallStmt("tmpfs", nil, nil, nil))
+		}
+
+		var alias *ast.AliasDecl
+		if mount.Output != pb.SkipOutput && d.uses[vertex{dgst, mount.Output}] > 0 {
+			alias = &ast.AliasDecl{
+				As:    &ast.As{Keyword: "as"},
+				Ident: ast.NewIdent(d.alias(vertex{dgst, mount.Output}, mount.Dest)),
+			}
+		}
+
+		opts = append(opts, ast.NewCallStmt("mount", []*ast.Expr{
+			input,
+			ast.NewStringExpr(mount.Dest),
+		}, newWithOpt(mountOpts), alias))
+	}
+
+	return ast.NewCallStmt("run", ast.NewStringExprs(decompileArgs(meta.Args)...), newWithOpt(opts), nil), nil
+}
+
+// decompileArgs returns the arguments of run for the args of an exec. Shell
+// scripts are written as a single argument, which run executes with /bin/sh.
+func decompileArgs(args []string) []string {
+	if len(args) == 3 && args[0] == "/bin/sh" && args[1] == "-c" {
+		parts, err := shellquote.Split(args[2])
+		if err == nil && len(parts) > 1 {
+			return args[2:]
+		}
+	}
+	return args
+}
+
+func decompileSecret(mount *pb.Mount) *ast.Stmt {
+	var opts []*ast.Stmt
+	secret := mount.SecretOpt
+	if secret != nil {
+		if secret.ID != "" {
+			opts = append(opts, ast.NewCallStmt("id", ast.NewStringExprs(secret.ID), nil, nil))
+		}
+		opts = append(opts, decompileFileOwner(secret.Uid, secret.Gid, secret.Mode, defaultSecretMode)...)
+		if secret.Optional {
+			opts = append(opts, ast.NewCommentStmt("optional"))
+		}
+	}
+	return ast.NewCallStmt("secret", ast.NewStringExprs(mount.Dest), newWithOpt(opts), nil)
+}
+
+func decompileSSH(mount *pb.Mount) *ast.Stmt {
+	opts := []*ast.Stmt{
+		ast.NewCallStmt("target", ast.NewStringExprs(mount.Dest), nil, nil),
+	}
+	ssh := mount.SSHOpt
+	if ssh != nil {
+		if ssh.ID != "" && ssh.ID != "default" {
+			opts = append(opts, ast.NewCallStmt("id", ast.NewStringExprs(ssh.ID), nil, nil))
+		}
+		opts = append(opts, decompileFileOwner(ssh.Uid, ssh.Gid, ssh.Mode, defaultSSHMode)...)
+		if ssh.Optional {
+			opts = append(opts, ast.NewCommentStmt("optional"))
+		}
+	}
+	return ast.NewCallStmt("ssh", nil, newWithOpt(opts), nil)
+}
+
+// decompileFileOwner returns the uid, gid and mode options of a secret or SSH
+// socket, which are set together if any of them isn't the default.
+func decompileFileOwner(uid, gid, mode, defaultMode uint32) []*ast.Stmt {
+	if uid == 0 && gid == 0 && mode == defaultMode {
+		return nil
+	}
+	return []*ast.Stmt{
+		ast.NewCallStmt("uid", []*ast.Expr{ast.NewDecimalExpr(int(uid))}, nil, nil),
+		ast.NewCallStmt("gid", []*ast.Expr{ast.NewDecimalExpr(int(gid))}, nil, nil),
+		ast.NewCallStmt("mode", []*ast.Expr{ast.NewNumericExpr(int64(mode), 8)}, nil, nil),
+	}
+}
+
+// decompileAction returns the statements that build the output of a file
+// action. Actions are chained to the result of earlier actions of the same
+// op by inputs past the inputs of the op.
+func (d *decompiler) decompileAction(op *pb.Op, file *pb.FileOp, i int) ([]*ast.Stmt, error) {
+	action := file.Actions[i]
+
+	var (
+		stmts []*ast.Stmt
+		err   error
+	)
+	switch {
+	case action.Input == pb.Empty:
+		stmts = append(stmts, ast.NewCallStmt("scratch", nil, nil, nil))
+	case int(action.Input) < len(op.Inputs):
+		var v vertex
+		v, err = inputVertex(op, action.Input)
+		if err == nil {
+			stmts, err = d.ref(v)
+		}
+	default:
+		var j int
+		j, err = earlierAction(op, i, action.Input)
+		if err == nil {
+			stmts, err = d.decompileAction(op, file, j)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch a := action.Action.(type) {
+	case *pb.FileAction_Mkdir:
+		var opts []*ast.Stmt
+		if a.Mkdir.MakeParents {
+			opts = append(opts, ast.NewCallStmt("createParents", nil, nil, nil))
+		}
+		opts = append(opts, decompileFileMeta(a.Mkdir.Owner, a.Mkdir.Timestamp)...)
+
+		stmts = append(stmts, ast.NewCallStmt("mkdir", []*ast.Expr{
+			ast.NewStringExpr(a.Mkdir.Path),
+			ast.NewNumericExpr(int64(fileMode(a.Mkdir.Mode, 0755)), 8),
+		}, newWithOpt(opts), nil))
+	case *pb.FileAction_Mkfile:
+		opts := decompileFileMeta(a.Mkfile.Owner, a.Mkfile.Timestamp)
+
+		stmts = append(stmts, ast.NewCallStmt("mkfile", []*ast.Expr{
+			ast.NewStringExpr(a.Mkfile.Path),
+			ast.NewNumericExpr(int64(fileMode(a.Mkfile.Mode, 0644)), 8),
+			ast.NewStringExpr(string(a.Mkfile.Data)),
+		}, newWithOpt(opts), nil))
+	case *pb.FileAction_Rm:
+		var opts []*ast.Stmt
+		if a.Rm.AllowNotFound {
+			opts = append(opts, ast.NewCallStmt("allowNotFound", nil, nil, nil))
+		}
+		if a.Rm.AllowWildcard {
+			opts = append(opts, ast.NewCallStmt("allowWildcard", nil, nil, nil))
+		}
+
+		stmts = append(stmts, ast.NewCallStmt("rm", ast.NewStringExprs(a.Rm.Path), newWithOpt(opts), nil))
+	case *pb.FileAction_Copy:
+		var input *ast.Expr
+		switch {
+		case action.SecondaryInput == pb.Empty || int(action.SecondaryInput) < len(op.Inputs):
+			input, err = d.refExpr(op, action.SecondaryInput)
+		default:
+			var j int
+			j, err = earlierAction(op, i, action.SecondaryInput)
+			if err == nil {
+				var secondary []*ast.Stmt
+				secondary, err = d.decompileAction(op, file, j)
+				input = ast.NewBlockLitExpr(ast.Filesystem, secondary...)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// AllowWildcard is lost, because copy has no option that is both
+		// checked and generated for it, so sources with wildcards are
+		// copied literally.
+		var opts []*ast.Stmt
+		for _, opt := range []struct {
+			name string
+			ok   bool
+		}{
+			{"followSymlinks", a.Copy.FollowSymlink},
+			{"contentsOnly", a.Copy.DirCopyContents},
+			{"unpack", a.Copy.AttemptUnpackDockerCompatibility},
+			{"createDestPath", a.Copy.CreateDestPath},
+			{"allowEmptyWildcard", a.Copy.AllowEmptyWildcard},
+		} {
+			if opt.ok {
+				opts = append(opts, ast.NewCallStmt(opt.name, nil, nil, nil))
+			}
+		}
+		opts = append(opts, decompileFileMeta(a.Copy.Owner, a.Copy.Timestamp)...)
+
+		stmts = append(stmts, ast.NewCallStmt("copy", []*ast.Expr{
+			input,
+			ast.NewStringExpr(a.Copy.Src),
+			ast.NewStringExpr(a.Copy.Dest),
+		}, newWithOpt(opts), nil))
+	default:
+		stmts = append(stmts, ast.NewCommentStmt(fmt.Sprintf("%T cannot be decompiled", action.Action)))
+	}
+	return stmts, nil
+}
+
+// earlierAction returns the index of the action that an input past the inputs
+// of the op refers to, which must be an action before the one using it.
+func earlierAction(op *pb.Op, i int, input pb.InputIndex) (int, error) {
+	j := int(input) - len(op.Inputs)
+	if j < 0 || j >= i {
+		return 0, fmt.Errorf("file action %d is missing input %d", i, input)
+	}
+	return j, nil
+}
+
+// decompileFileMeta returns the chown and createdTime options of a file
+// action.
+func decompileFileMeta(owner *pb.ChownOpt, timestamp int64) []*ast.Stmt {
+	var opts []*ast.Stmt
+	if owner != nil && owner.User != nil {
+		chown := userString(owner.User)
+		if owner.Group != nil {
+			chown = fmt.Sprintf("%s:%s", chown, userString(owner.Group))
+		}
+		opts = append(opts, ast.NewCallStmt("chown", ast.NewStringExprs(chown), nil, nil))
+	}
+	if timestamp != -1 {
+		created := time.Unix(0, timestamp).UTC().Format(time.RFC3339)
+		opts = append(opts, ast.NewCallStmt("createdTime", ast.NewStringExprs(created), nil, nil))
+	}
+	return opts
+}
+
+func userString(user *pb.UserOpt) string {
+	switch u := user.User.(type) {
+	case *pb.UserOpt_ByName:
+		return u.ByName.Name
+	case *pb.UserOpt_ByID:
+		return strconv.FormatUint(uint64(u.ByID), 10)
+	}
+	return ""
+}
+
+func fileMode(mode, defaultMode int32) int32 {
+	if mode == -1 {
+		return defaultMode
+	}
+	return mode
+}
+
+// isMount returns whether a vertex is the output of a mount other than the
+// root of an exec.
+func (d *decompiler) isMount(v vertex) bool {
+	exec, ok := d.ops[v.dgst].Op.(*pb.Op_Exec)
+	if !ok {
+		return false
+	}
+
+	root := rootMount(exec.Exec)
+	return root != nil && v.index != root.Output
+}
+
+func rootMount(exec *pb.ExecOp) *pb.Mount {
+	for _, mount := range exec.Mounts {
+		if mount.Dest == "/" {
+			return mount
+		}
+	}
+	return nil
+}
+
+// alias returns the name of the alias of a mount, which is named after its
+// mountpoint.
+func (d *decompiler) alias(v vertex, dest string) string {
+	name, ok := d.aliases[v]
+	if !ok {
+		name = d.names.Unique(path.Base(dest))
+		d.aliases[v] = name
+	}
+	return name
+}
+
+// vertexName returns a readable name for the function of a vertex.
+func (d *decompiler) vertexName(v vertex) string {
+	op := d.ops[v.dgst]
+	switch o := op.Op.(type) {
+	case *pb.Op_Source:
+		id := o.Source.Identifier
+		switch {
+		case strings.HasPrefix(id, "docker-image://"):
+			ref := familiarRef(strings.TrimPrefix(id, "docker-image://"))
+			if i := strings.IndexAny(ref, ":@"); i >= 0 {
+				ref = ref[:i]
+			}
+			return path.Base(ref)
+		case strings.HasPrefix(id, "git://"):
+			id = strings.SplitN(id, "#", 2)[0]
+			return strings.TrimSuffix(path.Base(id), ".git")
+		case strings.HasPrefix(id, "local://"):
+			return "context"
+		default:
+			return path.Base(id)
+		}
+	case *pb.Op_Exec:
+		args := decompileArgs(o.Exec.Meta.Args)
+		if len(args) == 0 {
+			return "run"
+		}
+		if parts, err := shellquote.Split(args[0]); err == nil && len(parts) > 0 {
+			return path.Base(parts[0])
+		}
+		return path.Base(args[0])
+	case *pb.Op_File:
+		return "files"
+	default:
+		return "build"
+	}
+}
+
+// familiarRef returns the shortest form of an image ref, which is how they
+// are usually written.
+func familiarRef(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ref
+	}
+	return reference.FamiliarString(named)
+}
+
+func newFuncDecl(name string, stmts ...*ast.Stmt) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Type:   ast.NewType(ast.Filesystem),
+		Name:   ast.NewIdent(name),
+		Params: &ast.FieldList{},
+		Body: &ast.BlockStmt{
+			List: stmts,
+		},
+	}
+}
+
+func newWithOpt(stmts []*ast.Stmt) *ast.WithOpt {
+	if len(stmts) == 0 {
+		return nil
+	}
+	return ast.NewWithBlockLit(stmts...)
+}
@@ -0,0 +1,124 @@
+package codegen
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecompile(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name     string
+		st       func() llb.State
+		expected string
+	}
+
+	for _, tc := range []testCase{{
+		"shared subgraphs and aliased mounts",
+		func() llb.State {
+			alpine := llb.Image("alpine")
+			out := alpine.Run(llb.Shlex("make build"), llb.Dir("/src")).AddMount("/out", llb.Scratch())
+			return alpine.File(llb.Copy(out, "/bin", "/usr/bin", &llb.CopyInfo{CreateDestPath: true}))
+		},
+		`
+fs alpine() {
+	image "alpine:latest"
+}
+
+fs make() {
+	alpine
+	run "make" "build" with option {
+		dir "/src"
+		mount fs {
+			scratch
+		} "/out" as out
+	}
+}
+
+fs default() {
+	alpine
+	copy fs {
+		out
+	} "/bin" "/usr/bin" with option {
+		createDestPath
+	}
+}
+`,
+	}, {
+		"file actions",
+		func() llb.State {
+			return llb.Scratch().
+				File(llb.Mkdir("/etc", 0755, llb.WithParents(true)).Mkfile("/etc/motd", 0644, []byte("hi"))).
+				File(llb.Rm("/tmp", llb.WithAllowNotFound(true)))
+		},
+		`
+fs default() {
+	scratch
+	mkdir "/etc" 0o755 with option {
+		createParents
+	}
+	mkfile "/etc/motd" 0o644 "hi"
+	rm "/tmp" with option {
+		allowNotFound
+	}
+}
+`,
+	}, {
+		"shell and cache mount",
+		func() llb.State {
+			run := llb.Git("https://github.com/openllb/hlb.git", "master").
+				Run(llb.Shlex(`/bin/sh -c "go build ./..."`))
+			run.AddMount("/root/.cache", llb.Scratch(), llb.AsPersistentCacheDir("go", llb.CacheMountShared))
+			return run.Root()
+		},
+		`
+fs default() {
+	git "https://github.com/openllb/hlb.git" "master"
+	run "go build ./..." with option {
+		mount fs {
+			scratch
+		} "/root/.cache" with option {
+			cache "go" "shared"
+		}
+	}
+}
+`,
+	}, {
+		"copy with owner",
+		func() llb.State {
+			return llb.Scratch().File(llb.Copy(llb.Image("alpine"), "/etc/passwd", "/etc/passwd", llb.WithUser("1000:nogroup"), llb.WithCreatedTime(time.Unix(0, 0))))
+		},
+		`
+fs default() {
+	scratch
+	copy fs {
+		image "alpine:latest"
+	} "/etc/passwd" "/etc/passwd" with option {
+		chown "1000:nogroup"
+		createdTime "1970-01-01T00:00:00Z"
+	}
+}
+`,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			def, err := tc.st().Marshal(llb.LinuxAmd64)
+			require.NoError(t, err)
+
+			file, err := Decompile(def)
+			require.NoError(t, err)
+			require.Equal(t, strings.TrimSpace(tc.expected), file.String())
+
+			_, err = report.SemanticCheck(file)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+)
+
+// ErrUnsupported is returned when a node cannot be generated, such as a call
+// to an unknown builtin in an AST that was never semantically checked.
+type ErrUnsupported struct {
+	Node ast.Node
+	What string
+}
+
+func (e ErrUnsupported) Error() string {
+	return fmt.Sprintf("%s unsupported %s", report.FormatPos(e.Node.Position()), e.What)
+}
+
+func (e ErrUnsupported) Position() lexer.Position { return e.Node.Position() }
+
+func (e ErrUnsupported) Code() string { return "unsupported" }
+
+// ErrWrongType is returned when a node evaluates to a value of another type
+// than where it is used, such as options of copy passed to run.
+type ErrWrongType struct {
+	Node     ast.Node
+	Expected string
+	Found    interface{}
+}
+
+func (e ErrWrongType) Error() string {
+	return fmt.Sprintf("%s expected %s, found %s", report.FormatPos(e.Node.Position()), e.Expected, typeName(e.Found))
+}
+
+func (e ErrWrongType) Position() lexer.Position { return e.Node.Position() }
+
+func (e ErrWrongType) Code() string { return "wrong-type" }
+
+// ErrNotLocked is returned when a remote source is missing from a lock that
+// is required to be up to date.
+type ErrNotLocked struct {
+	Call *ast.CallStmt
+	Kind string
+	Key  string
+}
+
+func (e ErrNotLocked) Error() string {
+	return fmt.Sprintf("%s %s %q is not locked, run hlb lock to update the lock", report.FormatPos(e.Call.Position()), e.Kind, e.Key)
+}
+
+func (e ErrNotLocked) Position() lexer.Position { return e.Call.Position() }
+
+func (e ErrNotLocked) Code() string { return "not-locked" }
+
+// ErrNotVendored is returned when generating offline a remote source that
+// wasn't vendored.
+type ErrNotVendored struct {
+	Call *ast.CallStmt
+	Kind string
+	Key  string
+}
+
+func (e ErrNotVendored) Error() string {
+	return fmt.Sprintf("%s %s %q is not vendored, run hlb vendor to build offline", report.FormatPos(e.Call.Position()), e.Kind, e.Key)
+}
+
+func (e ErrNotVendored) Position() lexer.Position { return e.Call.Position() }
+
+func (e ErrNotVendored) Code() string { return "not-vendored" }
+
+// typeName returns the HLB type of a value that nodes evaluate to.
+func typeName(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "nothing"
+	case ast.ObjType:
+		return string(t)
+	case string:
+		return string(ast.Str)
+	case int, int64:
+		return string(ast.Int)
+	case bool:
+		return string(ast.Bool)
+	case llb.State:
+		return string(ast.Filesystem)
+	case []interface{}:
+		return string(ast.Option)
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// checkNumArgs returns an error if a call to a builtin of a type has fewer
+// args than the builtin has params.
+func checkNumArgs(typ ast.ObjType, call *ast.CallStmt) error {
+	params, ok := report.Builtins[typ][call.Func.Name]
+	if !ok {
+		return nil
+	}
+
+	n := len(params)
+	if n > 0 && params[n-1].Variadic != nil {
+		n--
+	}
+
+	if len(call.Args) < n {
+		return report.ErrNumArgs{Expected: n, CallStmt: call}
+	}
+	return nil
+}
+
+// lookup returns the object in scope of an identifier.
+func lookup(scope *ast.Scope, ident *ast.Ident) (*ast.Object, error) {
+	obj := scope.Lookup(ident.Name)
+	if obj == nil {
+		return nil, report.ErrIdentNotDefined{Ident: ident}
+	}
+	return obj, nil
+}
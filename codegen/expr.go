@@ -8,7 +8,11 @@ import (
 func emitStringExpr(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt, expr *ast.Expr) (string, error) {
 	switch {
 	case expr.Ident != nil:
-		obj := scope.Lookup(expr.Ident.Name)
+		obj, err := lookup(scope, expr.Ident)
+		if err != nil {
+			return "", err
+		}
+
 		switch obj.Kind {
 		case ast.DeclKind:
 			switch n := obj.Node.(type) {
@@ -17,33 +21,49 @@ func emitStringExpr(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt, exp
 			case *ast.AliasDecl:
 				return emitStringAliasDecl(info, scope, n, call)
 			default:
-				panic("unknown decl object")
+				return "", ErrUnsupported{expr, "string decl"}
 			}
 		case ast.ExprKind:
-			return obj.Data.(string), nil
+			v, ok := obj.Data.(string)
+			if !ok {
+				return "", ErrWrongType{expr, "string", obj.Data}
+			}
+			return v, nil
 		default:
-			panic("unknown obj type")
+			return "", ErrUnsupported{expr, "string object"}
 		}
 	case expr.BasicLit != nil:
+		if expr.BasicLit.Str == nil {
+			return "", ErrWrongType{expr, "string", basicLitValue(expr.BasicLit)}
+		}
 		return *expr.BasicLit.Str, nil
 	case expr.BlockLit != nil:
+		if !expr.BlockLit.Type.Equals(ast.Str) {
+			return "", ErrWrongType{expr, "string", expr.BlockLit.Type.ObjType}
+		}
 		return emitStringBlock(info, scope, expr.BlockLit.Body.NonEmptyStmts())
 	default:
-		panic("unknown string expr")
+		return "", ErrUnsupported{expr, "string expr"}
 	}
 }
 
 func emitIntExpr(info *CodeGenInfo, scope *ast.Scope, expr *ast.Expr) (int, error) {
 	switch {
 	case expr.Ident != nil:
-		obj := scope.Lookup(expr.Ident.Name)
+		obj, err := lookup(scope, expr.Ident)
+		if err != nil {
+			return 0, err
+		}
+
 		switch obj.Kind {
-		case ast.DeclKind:
-			panic("unimplemented")
 		case ast.ExprKind:
-			return obj.Data.(int), nil
+			v, ok := obj.Data.(int)
+			if !ok {
+				return 0, ErrWrongType{expr, "int", obj.Data}
+			}
+			return v, nil
 		default:
-			panic("unknown obj type")
+			return 0, ErrUnsupported{expr, "int object"}
 		}
 	case expr.BasicLit != nil:
 		switch {
@@ -52,33 +72,38 @@ func emitIntExpr(info *CodeGenInfo, scope *ast.Scope, expr *ast.Expr) (int, erro
 		case expr.BasicLit.Numeric != nil:
 			return int(expr.BasicLit.Numeric.Value), nil
 		default:
-			panic("unknown int basic lit")
+			return 0, ErrWrongType{expr, "int", basicLitValue(expr.BasicLit)}
 		}
-	case expr.BlockLit != nil:
-		panic("unimplemented")
 	default:
-		panic("unknown int expr")
+		return 0, ErrUnsupported{expr, "int expr"}
 	}
 }
 
 func emitBoolExpr(info *CodeGenInfo, scope *ast.Scope, expr *ast.Expr) (bool, error) {
 	switch {
 	case expr.Ident != nil:
-		obj := scope.Lookup(expr.Ident.Name)
+		obj, err := lookup(scope, expr.Ident)
+		if err != nil {
+			return false, err
+		}
+
 		switch obj.Kind {
-		case ast.DeclKind:
-			panic("unimplemented")
 		case ast.ExprKind:
-			return obj.Data.(bool), nil
+			v, ok := obj.Data.(bool)
+			if !ok {
+				return false, ErrWrongType{expr, "bool", obj.Data}
+			}
+			return v, nil
 		default:
-			panic("unknown obj type")
+			return false, ErrUnsupported{expr, "bool object"}
 		}
 	case expr.BasicLit != nil:
+		if expr.BasicLit.Bool == nil {
+			return false, ErrWrongType{expr, "bool", basicLitValue(expr.BasicLit)}
+		}
 		return *expr.BasicLit.Bool, nil
-	case expr.BlockLit != nil:
-		panic("unimplemented")
 	default:
-		panic("unknown bool expr")
+		return false, ErrUnsupported{expr, "bool expr"}
 	}
 }
 
@@ -97,7 +122,11 @@ func maybeEmitBoolExpr(info *CodeGenInfo, scope *ast.Scope, args []*ast.Expr) (b
 func emitFilesystemExpr(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt, expr *ast.Expr, ac aliasCallback) (llb.State, error) {
 	switch {
 	case expr.Ident != nil:
-		obj := scope.Lookup(expr.Ident.Name)
+		obj, err := lookup(scope, expr.Ident)
+		if err != nil {
+			return llb.Scratch(), err
+		}
+
 		switch obj.Kind {
 		case ast.DeclKind:
 			switch n := obj.Node.(type) {
@@ -106,52 +135,84 @@ func emitFilesystemExpr(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt,
 			case *ast.AliasDecl:
 				return emitFilesystemAliasDecl(info, scope, n, call)
 			default:
-				panic("unknown decl object")
+				return llb.Scratch(), ErrUnsupported{expr, "fs decl"}
 			}
 		case ast.ExprKind:
-			return obj.Data.(llb.State), nil
+			st, ok := obj.Data.(llb.State)
+			if !ok {
+				return llb.Scratch(), ErrWrongType{expr, "fs", obj.Data}
+			}
+			return st, nil
 		default:
-			panic("unknown obj type")
+			return llb.Scratch(), ErrUnsupported{expr, "fs object"}
 		}
 	case expr.BasicLit != nil:
-		panic("fs expr cannot be basic lit")
+		return llb.Scratch(), ErrWrongType{expr, "fs", basicLitValue(expr.BasicLit)}
 	case expr.BlockLit != nil:
-		v, err := emitBlockLit(info, scope, expr.BlockLit, "", ac)
-		if err != nil {
-			return llb.Scratch(), err
+		if !expr.BlockLit.Type.Equals(ast.Filesystem) {
+			return llb.Scratch(), ErrWrongType{expr, "fs", expr.BlockLit.Type.ObjType}
 		}
-		return v.(llb.State), nil
+		return emitFilesystemBlock(info, scope, expr.BlockLit.Body.NonEmptyStmts(), ac)
 	default:
-		panic("unknown fs expr")
+		return llb.Scratch(), ErrUnsupported{expr, "fs expr"}
 	}
 }
 
 func emitOptionExpr(info *CodeGenInfo, scope *ast.Scope, call *ast.CallStmt, op string, expr *ast.Expr) ([]interface{}, error) {
 	switch {
 	case expr.Ident != nil:
-		obj := scope.Lookup(expr.Ident.Name)
+		obj, err := lookup(scope, expr.Ident)
+		if err != nil {
+			return nil, err
+		}
+
 		switch obj.Kind {
 		case ast.DeclKind:
 			switch n := obj.Node.(type) {
 			case *ast.FuncDecl:
 				return emitOptionFuncDecl(info, scope, n, call, op)
 			default:
-				panic("unknown option decl kind")
+				return nil, ErrUnsupported{expr, "option decl"}
 			}
 		case ast.ExprKind:
-			return obj.Data.([]interface{}), nil
+			iopts, ok := obj.Data.([]interface{})
+			if !ok {
+				return nil, ErrWrongType{expr, "option", obj.Data}
+			}
+			return iopts, nil
 		default:
-			panic("unknown obj type")
+			return nil, ErrUnsupported{expr, "option object"}
 		}
 	case expr.BasicLit != nil:
-		panic("option expr cannot be basic lit")
+		return nil, ErrWrongType{expr, "option", basicLitValue(expr.BasicLit)}
 	case expr.BlockLit != nil:
-		v, err := emitBlockLit(info, scope, expr.BlockLit, op, noopAliasCallback)
-		if err != nil {
-			return nil, err
+		if !expr.BlockLit.Type.Equals(ast.Option) {
+			return nil, ErrWrongType{expr, "option", expr.BlockLit.Type.ObjType}
 		}
-		return v.([]interface{}), nil
+		return emitOptions(info, scope, op, expr.BlockLit.Body.NonEmptyStmts(), noopAliasCallback)
+	default:
+		return nil, ErrUnsupported{expr, "option expr"}
+	}
+}
+
+// basicLitValue returns the value of a basic literal.
+func basicLitValue(lit *ast.BasicLit) interface{} {
+	switch {
+	case lit.Str != nil:
+		return *lit.Str
+	case lit.Decimal != nil:
+		return *lit.Decimal
+	case lit.Numeric != nil:
+		return lit.Numeric.Value
+	case lit.Bool != nil:
+		return *lit.Bool
 	default:
-		panic("unknown option expr")
+		return nil
 	}
 }
+
+// funcExpr returns the func of a call as an expression, so that errors
+// evaluating it point at the call.
+func funcExpr(call *ast.CallStmt) *ast.Expr {
+	return &ast.Expr{Pos: call.Func.Pos, Ident: call.Func}
+}
@@ -0,0 +1,174 @@
+package codegen
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGenerateRandomAST generates random ASTs with the ast.New* helpers, which
+// are often semantically invalid, and checks that generating them returns
+// errors instead of panicking.
+func TestGenerateRandomAST(t *testing.T) {
+	t.Parallel()
+
+	f := newASTFuzzer(rand.New(rand.NewSource(1)))
+	for i := 0; i < 1000; i++ {
+		file := f.file()
+
+		// Semantic errors are ignored so that invalid ASTs still reach
+		// codegen, which needs the scopes built by the check.
+		root, _ := report.SemanticCheck(file)
+
+		for _, decl := range file.Decls {
+			fun := decl.Func
+			if fun.Type.Type() != ast.Filesystem || fun.Params.NumFields() > 0 {
+				continue
+			}
+
+			call := ast.NewCallStmt(fun.Name.Name, nil, nil, nil).Call
+			require.NotPanics(t, func() {
+				_, _, _ = Generate(call, root)
+			}, "%s", file)
+		}
+	}
+}
+
+var fuzzTypes = []ast.ObjType{
+	ast.Filesystem,
+	ast.Str,
+	ast.Int,
+	ast.Bool,
+	ast.Option,
+	ast.OptionRun,
+	ast.OptionCopy,
+	ast.OptionMount,
+	ast.OptionImage,
+}
+
+type astFuzzer struct {
+	rand     *rand.Rand
+	builtins []string
+	names    []string
+}
+
+func newASTFuzzer(r *rand.Rand) *astFuzzer {
+	// Resolving images needs a registry, so it is never generated.
+	seen := map[string]struct{}{"resolve": {}}
+
+	var builtins []string
+	for _, fields := range report.Builtins {
+		for name := range fields {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			builtins = append(builtins, name)
+		}
+	}
+	sort.Strings(builtins)
+
+	return &astFuzzer{rand: r, builtins: builtins}
+}
+
+func (f *astFuzzer) file() *ast.File {
+	f.names = []string{"undefined"}
+
+	n := 1 + f.rand.Intn(4)
+	for i := 0; i < n; i++ {
+		f.names = append(f.names, fmt.Sprintf("f%d", i))
+	}
+
+	file := &ast.File{}
+	for i := 0; i < n; i++ {
+		file.Decls = append(file.Decls, &ast.Decl{Func: f.funcDecl(f.names[i+1])})
+	}
+	return file
+}
+
+func (f *astFuzzer) funcDecl(name string) *ast.FuncDecl {
+	typ := ast.Filesystem
+	if f.rand.Intn(2) == 0 {
+		typ = f.objType()
+	}
+
+	params := &ast.FieldList{}
+	for i := f.rand.Intn(3); i > 0; i-- {
+		param := fmt.Sprintf("p%d", i)
+		params.List = append(params.List, ast.NewField(f.objType(), param, f.rand.Intn(4) == 0))
+		f.names = append(f.names, param)
+	}
+
+	return &ast.FuncDecl{
+		Type:   ast.NewType(typ),
+		Name:   ast.NewIdent(name),
+		Params: params,
+		Body:   &ast.BlockStmt{List: f.stmts(3)},
+	}
+}
+
+func (f *astFuzzer) objType() ast.ObjType {
+	return fuzzTypes[f.rand.Intn(len(fuzzTypes))]
+}
+
+func (f *astFuzzer) name() string {
+	if f.rand.Intn(3) == 0 {
+		return f.names[f.rand.Intn(len(f.names))]
+	}
+	return f.builtins[f.rand.Intn(len(f.builtins))]
+}
+
+func (f *astFuzzer) stmts(depth int) []*ast.Stmt {
+	var stmts []*ast.Stmt
+	for i := f.rand.Intn(5); i > 0; i-- {
+		var args []*ast.Expr
+		for j := f.rand.Intn(4); j > 0; j-- {
+			args = append(args, f.expr(depth))
+		}
+
+		var with *ast.WithOpt
+		switch f.rand.Intn(4) {
+		case 0:
+			with = ast.NewWithIdent(f.name())
+		case 1:
+			if depth > 0 {
+				with = ast.NewWithBlockLit(f.stmts(depth - 1)...)
+			}
+		}
+
+		var alias *ast.AliasDecl
+		if f.rand.Intn(8) == 0 {
+			alias = &ast.AliasDecl{
+				As:    &ast.As{Keyword: "as"},
+				Ident: ast.NewIdent(fmt.Sprintf("a%d", len(f.names))),
+			}
+			f.names = append(f.names, alias.Ident.Name)
+		}
+
+		stmts = append(stmts, ast.NewCallStmt(f.name(), args, with, alias))
+	}
+	return stmts
+}
+
+func (f *astFuzzer) expr(depth int) *ast.Expr {
+	switch f.rand.Intn(6) {
+	case 0:
+		return ast.NewStringExpr(f.name())
+	case 1:
+		return ast.NewDecimalExpr(f.rand.Intn(1000))
+	case 2:
+		return ast.NewNumericExpr(int64(f.rand.Intn(0777)), 8)
+	case 3:
+		return ast.NewBoolExpr(f.rand.Intn(2) == 0)
+	case 4:
+		if depth > 0 {
+			return ast.NewBlockLitExpr(f.objType(), f.stmts(depth-1)...)
+		}
+	}
+	return ast.NewIdentExpr(f.name())
+}
@@ -0,0 +1,118 @@
+package codegen
+
+import (
+	"strings"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/openllb/hlb/ast"
+)
+
+// Kinds of remote sources that can be locked.
+const (
+	SourceImage = "image"
+	SourceGit   = "git"
+	SourceHTTP  = "http"
+)
+
+// Source is a remote source emitted while generating a target. Key identifies
+// the source in a Lock, which is the ref of an image, the remote and ref of a
+// git repository joined by "#", or the URL of an HTTP artifact. Locked is the
+// value substituted from a Lock, if any, and State is the source as emitted.
+type Source struct {
+	Kind   string
+	Key    string
+	Locked string
+	Call   *ast.CallStmt
+	State  llb.State
+}
+
+// Lock pins remote sources to immutable values, so that builds don't drift
+// when images, branches or artifacts are updated. Images are pinned to refs
+// with a digest, git refs to commits and HTTP artifacts to checksums.
+type Lock struct {
+	Images map[string]string `json:"images,omitempty"`
+	Git    map[string]string `json:"git,omitempty"`
+	HTTP   map[string]string `json:"http,omitempty"`
+}
+
+// NewLock returns an empty lock.
+func NewLock() *Lock {
+	return &Lock{
+		Images: make(map[string]string),
+		Git:    make(map[string]string),
+		HTTP:   make(map[string]string),
+	}
+}
+
+// Get returns the locked value of a source.
+func (l *Lock) Get(kind, key string) (string, bool) {
+	var v string
+	var ok bool
+	switch kind {
+	case SourceImage:
+		v, ok = l.Images[key]
+	case SourceGit:
+		v, ok = l.Git[key]
+	case SourceHTTP:
+		v, ok = l.HTTP[key]
+	}
+	return v, ok
+}
+
+// Set locks a source to a value.
+func (l *Lock) Set(kind, key, value string) {
+	switch kind {
+	case SourceImage:
+		l.Images[key] = value
+	case SourceGit:
+		l.Git[key] = value
+	case SourceHTTP:
+		l.HTTP[key] = value
+	}
+}
+
+// Merge locks the sources of another lock, replacing the values of sources
+// locked by both.
+func (l *Lock) Merge(other *Lock) {
+	for k, v := range other.Images {
+		l.Images[k] = v
+	}
+	for k, v := range other.Git {
+		l.Git[k] = v
+	}
+	for k, v := range other.HTTP {
+		l.HTTP[k] = v
+	}
+}
+
+// WithLock substitutes the locked values of remote sources. If locked is
+// true, sources missing from the lock are errors because the lock is stale.
+func WithLock(lock *Lock, locked bool) CodeGenOption {
+	return func(i *CodeGenInfo) error {
+		i.Lock = lock
+		i.Locked = locked
+		return nil
+	}
+}
+
+// lockSource returns the locked value of a remote source, or an empty string
+// if it isn't locked.
+func lockSource(info *CodeGenInfo, call *ast.CallStmt, kind, key string) (string, error) {
+	// Images pinned to a digest are already locked.
+	if kind == SourceImage && strings.Contains(key, "@") {
+		return "", nil
+	}
+
+	if info.Lock == nil {
+		if info.Locked {
+			return "", ErrNotLocked{call, kind, key}
+		}
+		return "", nil
+	}
+
+	v, ok := info.Lock.Get(kind, key)
+	if !ok && info.Locked {
+		return "", ErrNotLocked{call, kind, key}
+	}
+	return v, nil
+}
@@ -0,0 +1,92 @@
+package codegen
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateWithLock(t *testing.T) {
+	t.Parallel()
+
+	copyFrom := func(source *ast.Stmt) *ast.Stmt {
+		return ast.NewCallStmt("copy", []*ast.Expr{
+			ast.NewBlockLitExpr(ast.Filesystem, source),
+			ast.NewStringExpr("/"),
+			ast.NewStringExpr("/"),
+		}, nil, nil)
+	}
+
+	file := &ast.File{
+		Decls: []*ast.Decl{{
+			Func: &ast.FuncDecl{
+				Type:   ast.NewType(ast.Filesystem),
+				Name:   ast.NewIdent("default"),
+				Params: &ast.FieldList{},
+				Body: &ast.BlockStmt{List: []*ast.Stmt{
+					ast.NewCallStmt("image", []*ast.Expr{ast.NewStringExpr("alpine")}, nil, nil),
+					copyFrom(ast.NewCallStmt("git", []*ast.Expr{
+						ast.NewStringExpr("https://github.com/left-pad/left-pad.git"),
+						ast.NewStringExpr("master"),
+					}, nil, nil)),
+					copyFrom(ast.NewCallStmt("http", []*ast.Expr{
+						ast.NewStringExpr("https://example.com/artifact.tgz"),
+					}, nil, nil)),
+					copyFrom(ast.NewCallStmt("image", []*ast.Expr{
+						ast.NewStringExpr("busybox@sha256:6915be4043561d64e0ab0f8f098dc2ac48e077fe23f488ac24b665166898115a"),
+					}, nil, nil)),
+				}},
+			},
+		}},
+	}
+
+	root, err := report.SemanticCheck(file)
+	require.NoError(t, err)
+
+	generate := func(opts ...CodeGenOption) (llb.State, *CodeGenInfo, error) {
+		return Generate(ast.NewCallStmt("default", nil, nil, nil).Call, root, opts...)
+	}
+
+	_, info, err := generate()
+	require.NoError(t, err)
+
+	var keys []string
+	for _, source := range info.Sources {
+		keys = append(keys, source.Kind+" "+source.Key)
+	}
+	require.Equal(t, []string{
+		"image alpine",
+		"git https://github.com/left-pad/left-pad.git#master",
+		"http https://example.com/artifact.tgz",
+		"image busybox@sha256:6915be4043561d64e0ab0f8f098dc2ac48e077fe23f488ac24b665166898115a",
+	}, keys)
+
+	lock := NewLock()
+	lock.Set(SourceImage, "alpine", "alpine@sha256:ddba4d27a7ffc3f86dd6c2f92041af252a1f23a8e742c90e6e1297bfa1bc0c45")
+	lock.Set(SourceGit, "https://github.com/left-pad/left-pad.git#master", "2fca6157da4bf8b8e1e4a0c6e2dd8fe2f8b0f8a1")
+
+	_, _, err = generate(WithLock(lock, true))
+	require.Error(t, err)
+	require.IsType(t, ErrNotLocked{}, err)
+
+	lock.Set(SourceHTTP, "https://example.com/artifact.tgz", "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+
+	st, _, err := generate(WithLock(lock, true))
+	require.NoError(t, err)
+
+	def, err := st.Marshal(llb.LinuxAmd64)
+	require.NoError(t, err)
+
+	pb := bytes.Join(def.Def, nil)
+	for _, locked := range []string{
+		"alpine@sha256:ddba4d27a7ffc3f86dd6c2f92041af252a1f23a8e742c90e6e1297bfa1bc0c45",
+		"2fca6157da4bf8b8e1e4a0c6e2dd8fe2f8b0f8a1",
+		"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	} {
+		require.Contains(t, string(pb), locked)
+	}
+}
@@ -0,0 +1,188 @@
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/moby/buildkit/client/llb"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+)
+
+// Recording is a serializable log of every step taken by the code generator,
+// so that a debugger session can be replayed without BuildKit.
+type Recording struct {
+	Sources map[string]string `json:"sources"`
+	Steps   []*Step           `json:"steps"`
+}
+
+// Step is a snapshot of a single debugger step.
+type Step struct {
+	Pos      lexer.Position `json:"pos"`
+	Length   int            `json:"length"`
+	Node     string         `json:"node"`
+	Name     string         `json:"name,omitempty"`
+	Func     string         `json:"func,omitempty"`
+	Bindings []*Binding     `json:"bindings,omitempty"`
+	Value    *ValueSummary  `json:"value,omitempty"`
+}
+
+// Binding is a summary of a variable bound in the scope of a step.
+type Binding struct {
+	Name  string        `json:"name"`
+	Type  ast.ObjType   `json:"type"`
+	Value *ValueSummary `json:"value,omitempty"`
+}
+
+// ValueSummary is a serializable summary of a value produced by the code
+// generator.
+type ValueSummary struct {
+	Type     ast.ObjType   `json:"type"`
+	Value    string        `json:"value,omitempty"`
+	Digest   digest.Digest `json:"digest,omitempty"`
+	Dir      string        `json:"dir,omitempty"`
+	Env      []string      `json:"env,omitempty"`
+	Args     []string      `json:"args,omitempty"`
+	Network  string        `json:"network,omitempty"`
+	Security string        `json:"security,omitempty"`
+}
+
+// NewRecording returns an empty recording for the given sources.
+func NewRecording(ibs map[string]*report.IndexedBuffer) *Recording {
+	sources := make(map[string]string)
+	for filename, ib := range ibs {
+		sources[filename] = string(ib.Bytes())
+	}
+	return &Recording{Sources: sources}
+}
+
+// ReadRecording reads a recording previously written by Recording.Encode.
+func ReadRecording(r io.Reader) (*Recording, error) {
+	var rec Recording
+	err := json.NewDecoder(r).Decode(&rec)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// Encode writes the recording as JSON.
+func (rec *Recording) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rec)
+}
+
+// IndexedBuffers returns the recorded sources indexed by filename.
+func (rec *Recording) IndexedBuffers() (map[string]*report.IndexedBuffer, error) {
+	ibs := make(map[string]*report.IndexedBuffer)
+	for filename, source := range rec.Sources {
+		ib := report.NewIndexedBuffer()
+		_, err := ib.Write([]byte(source))
+		if err != nil {
+			return nil, err
+		}
+		ibs[filename] = ib
+	}
+	return ibs, nil
+}
+
+// Record returns a debugger that records a step before passing control to
+// dbgr.
+func (rec *Recording) Record(dbgr Debugger) Debugger {
+	return func(scope *ast.Scope, node ast.Node, value interface{}) error {
+		rec.Steps = append(rec.Steps, newStep(scope, node, value))
+		return dbgr(scope, node, value)
+	}
+}
+
+func newStep(scope *ast.Scope, node ast.Node, value interface{}) *Step {
+	step := &Step{
+		Pos:    node.Position(),
+		Length: 1,
+		Value:  summarize(value),
+	}
+
+	switch n := node.(type) {
+	case *ast.AST:
+		step.Node = "program"
+	case *ast.FuncDecl:
+		step.Node = "func"
+		step.Name = n.Name.Name
+		step.Length = n.Name.End().Column - n.Pos.Column
+	case *ast.CallStmt:
+		step.Node = "call"
+		step.Name = n.Func.Name
+		step.Length = n.Func.End().Column - n.Pos.Column
+	default:
+		step.Node = fmt.Sprintf("%T", node)
+	}
+
+	fun, ok := scope.Node.(*ast.FuncDecl)
+	if ok {
+		step.Func = fun.Name.Name
+
+		for _, param := range fun.Params.List {
+			binding := &Binding{
+				Name: param.Name.Name,
+				Type: param.Type.ObjType,
+			}
+
+			obj := scope.Lookup(param.Name.Name)
+			if obj != nil {
+				binding.Value = summarize(obj.Data)
+			}
+
+			step.Bindings = append(step.Bindings, binding)
+		}
+	}
+
+	return step
+}
+
+func summarize(value interface{}) *ValueSummary {
+	switch v := value.(type) {
+	case llb.State:
+		summary := &ValueSummary{
+			Type:     ast.Filesystem,
+			Dir:      v.GetDir(),
+			Env:      v.Env(),
+			Args:     v.GetArgs(),
+			Network:  v.GetNetwork().String(),
+			Security: v.GetSecurity().String(),
+		}
+
+		def, err := v.Marshal(llb.LinuxAmd64)
+		if err == nil && len(def.Def) > 0 {
+			summary.Digest = digest.FromBytes(def.Def[len(def.Def)-1])
+		}
+
+		return summary
+	case string:
+		return &ValueSummary{
+			Type:  ast.Str,
+			Value: strconv.Quote(v),
+		}
+	case int:
+		return &ValueSummary{
+			Type:  ast.Int,
+			Value: strconv.Itoa(v),
+		}
+	case bool:
+		return &ValueSummary{
+			Type:  ast.Bool,
+			Value: strconv.FormatBool(v),
+		}
+	case []interface{}:
+		return &ValueSummary{
+			Type:  ast.Option,
+			Value: fmt.Sprintf("%d options", len(v)),
+		}
+	default:
+		return nil
+	}
+}
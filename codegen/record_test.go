@@ -0,0 +1,84 @@
+package codegen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+)
+
+type namedReader struct {
+	*strings.Reader
+	name string
+}
+
+func (nr *namedReader) Name() string {
+	return nr.name
+}
+
+func TestRecordReplay(t *testing.T) {
+	t.Parallel()
+
+	source := `fs default() {
+	image "alpine"
+	dir "/src"
+	env "FOO" "bar"
+}
+`
+
+	ib := report.NewIndexedBuffer()
+	_, err := ib.Write([]byte(source))
+	require.NoError(t, err)
+	ibs := map[string]*report.IndexedBuffer{"test.hlb": ib}
+
+	file := &ast.File{}
+	err = ast.Parser.Parse(&namedReader{strings.NewReader(source), "test.hlb"}, file)
+	require.NoError(t, err)
+
+	root, err := report.SemanticCheck(file)
+	require.NoError(t, err)
+
+	// Commands that don't need BuildKit print the same output when live and
+	// when replayed.
+	commands := strings.Join([]string{
+		"dir",
+		"list",
+		"step",
+		"step",
+		"env",
+		"step",
+		"dir",
+		"step",
+		"dir",
+		"env",
+		"network",
+		"security",
+	}, "\n") + "\n"
+
+	var live bytes.Buffer
+	rec := NewRecording(ibs)
+	dbgr := NewDebugger(context.Background(), nil, &live, bufio.NewReader(strings.NewReader(commands+"continue\n")), ibs, make(map[string]string))
+
+	_, _, err = Generate(ast.NewCallStmt("default", nil, nil, nil).Call, root, WithDebugger(rec.Record(dbgr)))
+	require.NoError(t, err)
+	require.Len(t, rec.Steps, 5)
+
+	var buf bytes.Buffer
+	err = rec.Encode(&buf)
+	require.NoError(t, err)
+
+	read, err := ReadRecording(&buf)
+	require.NoError(t, err)
+	require.Len(t, read.Steps, 5)
+
+	var replayed bytes.Buffer
+	err = Replay(&replayed, bufio.NewReader(strings.NewReader(commands)), read)
+	require.NoError(t, err)
+	require.Equal(t, live.String(), replayed.String())
+	require.Contains(t, replayed.String(), `Working directory "/src"`)
+}
@@ -0,0 +1,227 @@
+package codegen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+	shellquote "github.com/kballard/go-shellquote"
+	"github.com/logrusorgru/aurora"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+)
+
+// Replay steps through a recorded debugger session. Only the information
+// captured in the recording is available, so commands that require BuildKit
+// such as exec or ls are not supported.
+func Replay(w io.Writer, r *bufio.Reader, rec *Recording) error {
+	color := aurora.NewAurora(true)
+
+	ibs, err := rec.IndexedBuffers()
+	if err != nil {
+		return err
+	}
+
+	if len(rec.Steps) == 0 {
+		fmt.Fprintf(w, "Recording has no steps\n")
+		return nil
+	}
+
+	var breakpoints []lexer.Position
+	for _, step := range rec.Steps {
+		if step.Node == "call" && report.Contains(report.Debugs, step.Name) {
+			breakpoints = append(breakpoints, step.Pos)
+		}
+	}
+
+	isBreakpoint := func(step *Step) bool {
+		for _, pos := range breakpoints {
+			if pos == step.Pos {
+				return true
+			}
+		}
+		return false
+	}
+
+	index := 0
+	show := func() error {
+		step := rec.Steps[index]
+		if step.Node == "program" {
+			fmt.Fprintf(w, "Program has not started yet\n")
+			return nil
+		}
+		return printListAt(color, ibs, w, step.Pos, step.Length)
+	}
+
+	for {
+		step := rec.Steps[index]
+
+		fmt.Fprint(w, "(hlb) ")
+
+		command, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		command = strings.Replace(command, "\n", "", -1)
+
+		if command == "" {
+			continue
+		}
+
+		args, err := shellquote.Split(command)
+		if err != nil {
+			return err
+		}
+
+		switch args[0] {
+		case "break", "b":
+			if step.Node == "program" {
+				fmt.Fprintf(w, "Program has not started yet\n")
+				continue
+			}
+			breakpoints = append(breakpoints, step.Pos)
+		case "breakpoints":
+			for i, pos := range breakpoints {
+				fmt.Fprintf(w, "Breakpoint %d %s\n", i, report.FormatPos(pos))
+			}
+		case "cat", "diff", "dot", "exec", "ls", "stat":
+			fmt.Fprintf(w, "%s is not available when replaying\n", args[0])
+		case "clear":
+			breakpoints = nil
+		case "continue", "c":
+			for index < len(rec.Steps)-1 {
+				index++
+				if isBreakpoint(rec.Steps[index]) {
+					break
+				}
+			}
+			err = show()
+			if err != nil {
+				return err
+			}
+		case "dir":
+			if step.Value == nil || step.Value.Type != ast.Filesystem {
+				fmt.Fprintf(w, "current step is not in a fs scope\n")
+				continue
+			}
+
+			fmt.Fprintf(w, "Working directory %q\n", step.Value.Dir)
+		case "env":
+			if step.Value == nil || step.Value.Type != ast.Filesystem {
+				fmt.Fprintf(w, "current step is not in a fs scope\n")
+				continue
+			}
+
+			fmt.Fprintf(w, "Environment %s\n", step.Value.Env)
+		case "exit":
+			return ErrDebugExit
+		case "help":
+			fmt.Fprintf(w, "# Inspect\n")
+			fmt.Fprintf(w, "help - shows this help message\n")
+			fmt.Fprintf(w, "list - show source code\n")
+			fmt.Fprintf(w, "locals - print local variables\n")
+			fmt.Fprintf(w, "print - print the value of the current step\n")
+			fmt.Fprintf(w, "# Movement\n")
+			fmt.Fprintf(w, "exit - exit the debugger\n")
+			fmt.Fprintf(w, "break - sets a breakpoint at the current step\n")
+			fmt.Fprintf(w, "breakpoints - print out info for active breakpoints\n")
+			fmt.Fprintf(w, "clear - deletes all breakpoints\n")
+			fmt.Fprintf(w, "continue - replay until breakpoint or end of recording\n")
+			fmt.Fprintf(w, "next - step over to next source line\n")
+			fmt.Fprintf(w, "step - single step through recording\n")
+			fmt.Fprintf(w, "reverse-step - single step backwards through recording\n")
+			fmt.Fprintf(w, "restart - restart recording from the start\n")
+			fmt.Fprintf(w, "# Filesystem\n")
+			fmt.Fprintf(w, "dir - print working directory\n")
+			fmt.Fprintf(w, "env - print environment\n")
+			fmt.Fprintf(w, "network - print network mode\n")
+			fmt.Fprintf(w, "security - print security mode\n")
+		case "list", "l":
+			err = show()
+			if err != nil {
+				return err
+			}
+		case "locals":
+			for _, binding := range step.Bindings {
+				fmt.Fprintf(w, "%s %s = %s\n", binding.Type, binding.Name, formatSummary(binding.Value))
+			}
+		case "next", "n":
+			next := index
+			for i := index + 1; i < len(rec.Steps); i++ {
+				if rec.Steps[i].Func == step.Func {
+					next = i
+					break
+				}
+			}
+			if next == index {
+				fmt.Fprintf(w, "End of recording\n")
+				continue
+			}
+			index = next
+			err = show()
+			if err != nil {
+				return err
+			}
+		case "network":
+			if step.Value == nil || step.Value.Type != ast.Filesystem {
+				fmt.Fprintf(w, "current step is not in a fs scope\n")
+				continue
+			}
+
+			fmt.Fprintf(w, "Network %s\n", step.Value.Network)
+		case "print":
+			fmt.Fprintf(w, "%s\n", formatSummary(step.Value))
+		case "restart", "r":
+			index = 0
+			err = show()
+			if err != nil {
+				return err
+			}
+		case "reverse-step", "rs":
+			if index == 0 {
+				fmt.Fprintf(w, "Already at the start of the program\n")
+				continue
+			}
+			index--
+			err = show()
+			if err != nil {
+				return err
+			}
+		case "security":
+			if step.Value == nil || step.Value.Type != ast.Filesystem {
+				fmt.Fprintf(w, "current step is not in a fs scope\n")
+				continue
+			}
+
+			fmt.Fprintf(w, "Security %s\n", step.Value.Security)
+		case "step", "s":
+			if index == len(rec.Steps)-1 {
+				fmt.Fprintf(w, "End of recording\n")
+				continue
+			}
+			index++
+			err = show()
+			if err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintf(w, "unrecognized command %s\n", command)
+		}
+	}
+}
+
+func formatSummary(summary *ValueSummary) string {
+	if summary == nil {
+		return "<nil>"
+	}
+	if summary.Digest != "" {
+		return fmt.Sprintf("%s %s", summary.Type, summary.Digest)
+	}
+	return summary.Value
+}
@@ -0,0 +1,176 @@
+package codegen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+const (
+	scriptPrompt = "(hlb) "
+	scriptExpect = "> "
+)
+
+// Script feeds debugger commands from a command file and checks the output of
+// each command against the expectations written in the file.
+//
+// Each non-empty line of a command file is a debugger command, except lines
+// starting with "#" which are comments. A command may be followed by lines
+// starting with "> " that make up its expected output, in which case the
+// output of that command must match exactly. Output is compared without
+// colors and trailing whitespace.
+//
+// Once the commands are exhausted, the script reads from the fallback reader
+// if there is one, otherwise it keeps continuing until the program ends.
+//
+// A Script is both the io.Reader and io.Writer of a debugger, and must be
+// read through a bufio.Reader so that the debugger sees one command per read.
+type Script struct {
+	name     string
+	cmds     []*scriptCommand
+	index    int
+	current  *scriptCommand
+	w        io.Writer
+	fallback io.Reader
+	out      bytes.Buffer
+	errs     []string
+}
+
+type scriptCommand struct {
+	line     int
+	command  string
+	expected []string
+}
+
+// NewScript parses a command file read from r. Debugger output is written to
+// w as well as being checked.
+func NewScript(name string, r io.Reader, w io.Writer, fallback io.Reader) (*Script, error) {
+	s := &Script{
+		name:     name,
+		w:        w,
+		fallback: fallback,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for ln := 1; scanner.Scan(); ln++ {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, scriptExpect) || line == strings.TrimSpace(scriptExpect):
+			if len(s.cmds) == 0 {
+				return nil, fmt.Errorf("%s:%d: expected output before any command", name, ln)
+			}
+
+			cmd := s.cmds[len(s.cmds)-1]
+			if cmd.expected == nil {
+				cmd.expected = []string{}
+			}
+			if strings.HasPrefix(line, scriptExpect) {
+				cmd.expected = append(cmd.expected, strings.TrimPrefix(line, scriptExpect))
+			}
+		case strings.HasPrefix(strings.TrimSpace(line), "#"), strings.TrimSpace(line) == "":
+			continue
+		default:
+			s.cmds = append(s.cmds, &scriptCommand{
+				line:    ln,
+				command: strings.TrimSpace(line),
+			})
+		}
+	}
+
+	return s, scanner.Err()
+}
+
+// Write captures debugger output for the current command.
+func (s *Script) Write(p []byte) (int, error) {
+	s.out.Write(p)
+	return s.w.Write(p)
+}
+
+// Read returns the next command, checking the output of the previous command.
+func (s *Script) Read(p []byte) (int, error) {
+	s.check()
+
+	if s.index == len(s.cmds) {
+		if s.fallback != nil {
+			return s.fallback.Read(p)
+		}
+
+		// Run the rest of the program non-interactively.
+		return s.echo(p, "continue")
+	}
+
+	s.current = s.cmds[s.index]
+	s.index++
+	return s.echo(p, s.current.command)
+}
+
+// Err checks the output of the last command and returns an error describing
+// every command whose output did not match its expectations.
+func (s *Script) Err() error {
+	s.check()
+
+	if len(s.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("debugger output did not match expectations:\n%s", strings.Join(s.errs, "\n"))
+}
+
+func (s *Script) echo(p []byte, command string) (int, error) {
+	fmt.Fprintln(s.w, command)
+
+	line := command + "\n"
+	if len(p) < len(line) {
+		return 0, io.ErrShortBuffer
+	}
+	return copy(p, line), nil
+}
+
+func (s *Script) check() {
+	cmd := s.current
+	s.current = nil
+
+	out := ansiEscape.ReplaceAllString(s.out.String(), "")
+	s.out.Reset()
+
+	if cmd == nil || cmd.expected == nil {
+		return
+	}
+
+	out = strings.TrimSuffix(out, scriptPrompt)
+
+	var actual []string
+	if out != "" {
+		for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+			actual = append(actual, strings.TrimRight(line, " \t"))
+		}
+	}
+
+	expected := make([]string, len(cmd.expected))
+	for i, line := range cmd.expected {
+		expected[i] = strings.TrimRight(line, " \t")
+	}
+
+	if strings.Join(actual, "\n") == strings.Join(expected, "\n") {
+		return
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "%s:%d: %s\n", s.name, cmd.line, cmd.command)
+	fmt.Fprintf(&msg, "--- expected\n")
+	for _, line := range expected {
+		fmt.Fprintf(&msg, "%s%s\n", scriptExpect, line)
+	}
+	fmt.Fprintf(&msg, "--- actual\n")
+	for _, line := range actual {
+		fmt.Fprintf(&msg, "%s%s\n", scriptExpect, line)
+	}
+	s.errs = append(s.errs, strings.TrimSuffix(msg.String(), "\n"))
+}
@@ -0,0 +1,124 @@
+package codegen
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScript(t *testing.T) {
+	type output struct {
+		command string
+		lines   []string
+	}
+
+	for _, tc := range []struct {
+		name     string
+		script   string
+		outputs  []output
+		commands []string
+		err      string
+	}{{
+		"no expectations",
+		`
+		# comment
+		break
+
+		continue
+		`,
+		[]output{
+			{"break", nil},
+			{"continue", []string{"anything"}},
+			{"continue", nil},
+		},
+		[]string{"break", "continue", "continue"},
+		"",
+	}, {
+		"matching expectations",
+		`
+		dir
+		> Working directory "/"
+		env
+		> Environment [PATH=/bin]
+		`,
+		[]output{
+			{"dir", []string{`Working directory "/"`}},
+			{"env", []string{"\x1b[1mEnvironment [PATH=/bin]\x1b[0m  "}},
+		},
+		[]string{"dir", "env"},
+		"",
+	}, {
+		"mismatched expectations",
+		`
+		dir
+		> Working directory "/"
+		env
+		> Environment []
+		`,
+		[]output{
+			{"dir", []string{`Working directory "/src"`}},
+			{"env", []string{"Environment []"}},
+		},
+		[]string{"dir", "env"},
+		`test.txt:1: dir
+--- expected
+> Working directory "/"
+--- actual
+> Working directory "/src"`,
+	}, {
+		"empty expectation",
+		`
+		break
+		>
+		`,
+		[]output{
+			{"break", []string{"Breakpoint set"}},
+		},
+		[]string{"break"},
+		"test.txt:1: break",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			script, err := NewScript("test.txt", strings.NewReader(cleanup(tc.script)), ioutil.Discard, nil)
+			require.NoError(t, err)
+
+			r := bufio.NewReader(script)
+
+			var commands []string
+			for _, out := range tc.outputs {
+				fmt.Fprint(script, scriptPrompt)
+
+				command, err := r.ReadString('\n')
+				require.NoError(t, err)
+				commands = append(commands, strings.TrimSuffix(command, "\n"))
+
+				for _, line := range out.lines {
+					fmt.Fprintln(script, line)
+				}
+			}
+			require.Equal(t, tc.commands, commands)
+
+			err = script.Err()
+			if tc.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func cleanup(value string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(value), "\n") {
+		lines = append(lines, strings.TrimLeft(line, "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
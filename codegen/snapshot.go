@@ -0,0 +1,337 @@
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/openllb/hlb/ast"
+)
+
+const (
+	// SourcePositionKey is the LLB op metadata description key for the HLB
+	// source position of the call statement that emitted the op.
+	SourcePositionKey = "hlb.position"
+)
+
+func withSourcePosition(call *ast.CallStmt) llb.ConstraintsOpt {
+	return llb.WithDescription(map[string]string{
+		SourcePositionKey: fmt.Sprintf("%s:%d:%d", call.Pos.Filename, call.Pos.Line, call.Pos.Column),
+	})
+}
+
+// LLBSnapshot is a stable, canonical rendering of a LLB definition that can be
+// checked in as a golden file. Ops are sorted by digest and carry the HLB
+// source position that emitted them.
+type LLBSnapshot struct {
+	Ops []*LLBSnapshotOp `json:"ops"`
+}
+
+// LLBSnapshotOp is a single vertex of a LLB definition.
+type LLBSnapshotOp struct {
+	Digest   digest.Digest   `json:"digest"`
+	Position string          `json:"position,omitempty"`
+	Inputs   []digest.Digest `json:"inputs,omitempty"`
+
+	// Op is the JSON form of the op without its inputs.
+	Op       interface{}    `json:"op"`
+	Metadata *pb.OpMetadata `json:"metadata,omitempty"`
+}
+
+// NewLLBSnapshot renders a LLB definition as a snapshot.
+func NewLLBSnapshot(def *llb.Definition) (*LLBSnapshot, error) {
+	ops, err := loadLLB(def)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &LLBSnapshot{}
+	for _, op := range ops {
+		sop := &LLBSnapshotOp{
+			Digest:   op.Digest,
+			Position: op.OpMetadata.Description[SourcePositionKey],
+		}
+
+		for _, input := range op.Op.Inputs {
+			sop.Inputs = append(sop.Inputs, input.Digest)
+		}
+
+		// Round trip through JSON so that snapshots are compared the same way
+		// whether they are created or read from a file.
+		dt, err := json.Marshal(op.Op)
+		if err != nil {
+			return nil, err
+		}
+
+		var v map[string]interface{}
+		err = json.Unmarshal(dt, &v)
+		if err != nil {
+			return nil, err
+		}
+		delete(v, "inputs")
+		sop.Op = v
+
+		metadata := op.OpMetadata
+		if !reflect.DeepEqual(metadata, pb.OpMetadata{}) {
+			sop.Metadata = &metadata
+		}
+
+		snapshot.Ops = append(snapshot.Ops, sop)
+	}
+
+	sort.SliceStable(snapshot.Ops, func(i, j int) bool {
+		return snapshot.Ops[i].Digest < snapshot.Ops[j].Digest
+	})
+	return snapshot, nil
+}
+
+// ReadLLBSnapshot reads a snapshot written by Encode.
+func ReadLLBSnapshot(r io.Reader) (*LLBSnapshot, error) {
+	var snapshot LLBSnapshot
+	err := json.NewDecoder(r).Decode(&snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// Encode writes the snapshot as indented JSON.
+func (s *LLBSnapshot) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// DiffLLBSnapshots writes the vertices that were removed, added or changed
+// between snapshots a and b, and returns whether there were any. Vertices
+// with different digests are considered the same vertex if they were emitted
+// from the same HLB source position, in which case the fields and inputs that
+// changed are explained.
+func DiffLLBSnapshots(w io.Writer, a, b *LLBSnapshot) (bool, error) {
+	aOps := make(map[digest.Digest]*LLBSnapshotOp)
+	for _, op := range a.Ops {
+		aOps[op.Digest] = op
+	}
+
+	bOps := make(map[digest.Digest]*LLBSnapshotOp)
+	for _, op := range b.Ops {
+		bOps[op.Digest] = op
+	}
+
+	var removed, added []*LLBSnapshotOp
+	for _, op := range a.Ops {
+		if _, ok := bOps[op.Digest]; !ok {
+			removed = append(removed, op)
+		}
+	}
+	for _, op := range b.Ops {
+		if _, ok := aOps[op.Digest]; !ok {
+			added = append(added, op)
+		}
+	}
+
+	var changes []*llbChange
+
+	// Pair up removed and added ops from the same source position.
+	removedByPos := make(map[string][]*LLBSnapshotOp)
+	for _, op := range removed {
+		if op.Position != "" {
+			removedByPos[op.Position] = append(removedByPos[op.Position], op)
+		}
+	}
+
+	paired := make(map[digest.Digest]struct{})
+	for _, op := range added {
+		candidates := removedByPos[op.Position]
+		if op.Position == "" || len(candidates) != 1 {
+			continue
+		}
+
+		prev := candidates[0]
+		changes = append(changes, &llbChange{
+			kind:    "~",
+			op:      op,
+			prev:    prev,
+			reasons: explainChange(prev, op),
+		})
+		paired[prev.Digest] = struct{}{}
+		paired[op.Digest] = struct{}{}
+	}
+
+	for _, op := range removed {
+		if _, ok := paired[op.Digest]; !ok {
+			changes = append(changes, &llbChange{kind: "-", op: op})
+		}
+	}
+	for _, op := range added {
+		if _, ok := paired[op.Digest]; !ok {
+			changes = append(changes, &llbChange{kind: "+", op: op})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].op.Position != changes[j].op.Position {
+			return changes[i].op.Position < changes[j].op.Position
+		}
+		return changes[i].op.Digest < changes[j].op.Digest
+	})
+
+	for _, change := range changes {
+		fmt.Fprintf(w, "%s\n", change)
+		for _, reason := range change.reasons {
+			fmt.Fprintf(w, "    %s\n", reason)
+		}
+	}
+
+	return len(changes) > 0, nil
+}
+
+type llbChange struct {
+	kind    string
+	op      *LLBSnapshotOp
+	prev    *LLBSnapshotOp
+	reasons []string
+}
+
+func (c *llbChange) String() string {
+	name := describeOp(c.op)
+	if c.op.Position != "" {
+		name = fmt.Sprintf("%s %s", c.op.Position, name)
+	}
+
+	switch c.kind {
+	case "~":
+		return fmt.Sprintf("~ %s (%s -> %s)", name, shortDigest(c.prev.Digest), shortDigest(c.op.Digest))
+	default:
+		return fmt.Sprintf("%s %s (%s)", c.kind, name, shortDigest(c.op.Digest))
+	}
+}
+
+// explainChange returns the reasons an op has a different digest than its
+// previous version.
+func explainChange(prev, op *LLBSnapshotOp) []string {
+	var reasons []string
+	diffValues(&reasons, "", prev.Op, op.Op)
+
+	if len(prev.Inputs) != len(op.Inputs) {
+		reasons = append(reasons, fmt.Sprintf("number of inputs changed: %d -> %d", len(prev.Inputs), len(op.Inputs)))
+	} else {
+		for i := range op.Inputs {
+			if prev.Inputs[i] != op.Inputs[i] {
+				reasons = append(reasons, fmt.Sprintf("input %d changed: %s -> %s", i, shortDigest(prev.Inputs[i]), shortDigest(op.Inputs[i])))
+			}
+		}
+	}
+
+	return reasons
+}
+
+// diffValues appends a reason for every leaf that differs between two values
+// decoded from JSON.
+func diffValues(reasons *[]string, path string, a, b interface{}) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make(map[string]struct{})
+		for k := range av {
+			keys[k] = struct{}{}
+		}
+		for k := range bv {
+			keys[k] = struct{}{}
+		}
+
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		for _, k := range sorted {
+			p := k
+			if path != "" {
+				p = fmt.Sprintf("%s.%s", path, k)
+			}
+			diffValues(reasons, p, av[k], bv[k])
+		}
+		return
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			break
+		}
+
+		for i := range av {
+			diffValues(reasons, fmt.Sprintf("%s[%d]", path, i), av[i], bv[i])
+		}
+		return
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	*reasons = append(*reasons, fmt.Sprintf("%s: %s -> %s", path, formatValue(a), formatValue(b)))
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	dt, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(dt)
+}
+
+// describeOp returns a short human readable description of an op, similar to
+// the labels of the debugger's dot graph.
+func describeOp(op *LLBSnapshotOp) string {
+	v, ok := op.Op.(map[string]interface{})
+	if !ok {
+		return "op"
+	}
+
+	// The last op of a definition only points at the final vertex.
+	oneof, ok := v["Op"].(map[string]interface{})
+	if !ok {
+		return "return"
+	}
+
+	for kind, value := range oneof {
+		fields, _ := value.(map[string]interface{})
+		switch kind {
+		case "Source":
+			return fmt.Sprintf("source %v", fields["identifier"])
+		case "Exec":
+			meta, _ := fields["meta"].(map[string]interface{})
+			args, _ := meta["args"].([]interface{})
+
+			var strs []string
+			for _, arg := range args {
+				strs = append(strs, fmt.Sprintf("%v", arg))
+			}
+			return fmt.Sprintf("exec %s", strings.Join(strs, " "))
+		default:
+			return strings.ToLower(kind)
+		}
+	}
+	return "op"
+}
+
+func shortDigest(dgst digest.Digest) string {
+	hex := dgst.Hex()
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
@@ -0,0 +1,61 @@
+package codegen
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/openllb/hlb/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLBSnapshot(t *testing.T) {
+	t.Parallel()
+
+	callAt := func(line int) *ast.CallStmt {
+		return &ast.CallStmt{
+			Pos: lexer.Position{Filename: "test.hlb", Line: line, Column: 2},
+		}
+	}
+
+	snapshot := func(arg string) *LLBSnapshot {
+		st := llb.Image("alpine", withSourcePosition(callAt(2))).
+			Run(llb.Shlex("echo "+arg), withSourcePosition(callAt(3))).
+			Root()
+
+		def, err := st.Marshal(llb.LinuxAmd64)
+		require.NoError(t, err)
+
+		s, err := NewLLBSnapshot(def)
+		require.NoError(t, err)
+		return s
+	}
+
+	a := snapshot("a")
+	for i := 1; i < len(a.Ops); i++ {
+		require.True(t, a.Ops[i-1].Digest < a.Ops[i].Digest)
+	}
+
+	var buf bytes.Buffer
+	err := a.Encode(&buf)
+	require.NoError(t, err)
+
+	read, err := ReadLLBSnapshot(&buf)
+	require.NoError(t, err)
+	require.Equal(t, a, read)
+
+	var diff bytes.Buffer
+	changed, err := DiffLLBSnapshots(&diff, a, a)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Empty(t, diff.String())
+
+	b := snapshot("b")
+	changed, err = DiffLLBSnapshots(&diff, a, b)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Contains(t, diff.String(), "~ test.hlb:3:2 exec echo b")
+	require.Contains(t, diff.String(), `Op.Exec.meta.args[1]: "a" -> "b"`)
+	require.NotContains(t, diff.String(), "test.hlb:2:2")
+}
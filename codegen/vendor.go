@@ -0,0 +1,57 @@
+package codegen
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/moby/buildkit/client/llb"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	// VendorContentDir is the directory in a vendored source with its
+	// filesystem.
+	VendorContentDir = "content"
+)
+
+// WithOffline replaces git and http sources with their copies vendored to a
+// directory by hlb vendor. Images are not vendored, so they must still be
+// available to BuildKit, for example from its cache or a registry mirror.
+func WithOffline(vendorDir string) CodeGenOption {
+	return func(i *CodeGenInfo) error {
+		i.VendorDir = vendorDir
+		return nil
+	}
+}
+
+// VendorPath returns the directory in vendorDir that a remote source is
+// vendored to.
+func VendorPath(vendorDir, kind, key string) string {
+	return filepath.Join(vendorDir, kind, digest.FromString(key).Encoded())
+}
+
+// emitRemoteSource records a remote source, and replaces it with a local of
+// its vendored copy when generating offline.
+//
+// Images are left as is, because a local can only hold the flattened
+// filesystem of an image, without its layers, the ownership of its files or
+// its image config.
+func emitRemoteSource(info *CodeGenInfo, source Source) (llb.State, error) {
+	info.Sources = append(info.Sources, source)
+
+	st, call, kind, key := source.State, source.Call, source.Kind, source.Key
+	if info.VendorDir == "" || kind == SourceImage {
+		return st, nil
+	}
+
+	dir := VendorPath(info.VendorDir, kind, key)
+	_, err := os.Stat(filepath.Join(dir, VendorContentDir))
+	if err != nil {
+		return st, ErrNotVendored{call, kind, key}
+	}
+
+	id := string(digest.FromString(dir))
+	info.Locals[id] = filepath.Join(dir, VendorContentDir)
+
+	return llb.Local(id, llb.SharedKeyHint(key), withSourcePosition(call)), nil
+}
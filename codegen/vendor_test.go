@@ -0,0 +1,70 @@
+package codegen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateOffline(t *testing.T) {
+	t.Parallel()
+
+	vendorDir, err := ioutil.TempDir("", "hlb-vendor")
+	require.NoError(t, err)
+	defer os.RemoveAll(vendorDir)
+
+	file := &ast.File{
+		Decls: []*ast.Decl{{
+			Func: &ast.FuncDecl{
+				Type:   ast.NewType(ast.Filesystem),
+				Name:   ast.NewIdent("default"),
+				Params: &ast.FieldList{},
+				Body: &ast.BlockStmt{List: []*ast.Stmt{
+					ast.NewCallStmt("image", []*ast.Expr{
+						ast.NewStringExpr("golang:alpine"),
+					}, nil, nil),
+					ast.NewCallStmt("copy", []*ast.Expr{
+						ast.NewBlockLitExpr(ast.Filesystem, ast.NewCallStmt("http", []*ast.Expr{
+							ast.NewStringExpr("https://example.com/artifact.tgz"),
+						}, nil, nil)),
+						ast.NewStringExpr("/"),
+						ast.NewStringExpr("/"),
+					}, nil, nil),
+				}},
+			},
+		}},
+	}
+
+	root, err := report.SemanticCheck(file)
+	require.NoError(t, err)
+
+	generate := func() (llb.State, *CodeGenInfo, error) {
+		return Generate(ast.NewCallStmt("default", nil, nil, nil).Call, root, WithOffline(vendorDir))
+	}
+
+	_, _, err = generate()
+	require.Error(t, err)
+	require.IsType(t, ErrNotVendored{}, err)
+	require.Equal(t, SourceHTTP, err.(ErrNotVendored).Kind)
+
+	dir := VendorPath(vendorDir, SourceHTTP, "https://example.com/artifact.tgz")
+	err = os.MkdirAll(filepath.Join(dir, VendorContentDir), 0755)
+	require.NoError(t, err)
+
+	_, info, err := generate()
+	require.NoError(t, err)
+
+	// Only the http source is replaced, images are left as is.
+	require.Len(t, info.Locals, 1)
+	for _, path := range info.Locals {
+		require.Equal(t, filepath.Join(dir, VendorContentDir), path)
+	}
+	require.Len(t, info.Sources, 2)
+	require.Equal(t, SourceImage, info.Sources[0].Kind)
+}
@@ -0,0 +1,381 @@
+package hlb
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+)
+
+// DockerfileContext is the local that the build context of a converted
+// Dockerfile is read from.
+const DockerfileContext = "."
+
+var urlRegexp = regexp.MustCompile(`^https?://`)
+
+// ConvertDockerfile converts a Dockerfile to a HLB file. Every stage becomes
+// a fs function named after the stage, and the last stage becomes the
+// default function. Instructions without an equivalent in HLB are kept as
+// comments, and so are instructions with variables that are only known when
+// building, such as build arguments without a default.
+func ConvertDockerfile(r io.Reader) (*ast.File, error) {
+	result, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stages, metaArgs, err := instructions.Parse(result.AST)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("dockerfile has no stages")
+	}
+
+	cv := &dockerfileConverter{
+		stages:   stages,
+		names:    stageNames(stages),
+		envs:     make([]map[string]string, len(stages)),
+		metaArgs: make(map[string]string),
+		lex:      shell.NewLex(result.EscapeToken),
+		unsetLex: shell.NewLex(result.EscapeToken),
+	}
+	cv.unsetLex.SkipUnsetEnv = true
+
+	var doc []string
+	for _, arg := range metaArgs {
+		doc = append(doc, instructionCode(&arg))
+		cv.setArg(cv.metaArgs, arg, cv.metaArgs)
+	}
+
+	file := &ast.File{
+		Doc: ast.NewCommentGroup(doc...),
+	}
+	for i, stage := range stages {
+		fun, err := cv.convertStage(i, stage)
+		if err != nil {
+			return nil, err
+		}
+		file.Decls = append(file.Decls, &ast.Decl{Func: fun})
+	}
+	return file, nil
+}
+
+type dockerfileConverter struct {
+	stages []instructions.Stage
+
+	// names are the names of the functions that stages are converted to.
+	names []string
+
+	// envs are the environments of converted stages, which are inherited by
+	// stages based on them.
+	envs []map[string]string
+
+	// metaArgs are the defaults of the ARG instructions before the first
+	// stage.
+	metaArgs map[string]string
+
+	// lex expands variables, and unsetLex keeps unset variables so that
+	// words with variables unknown until building can be detected.
+	lex, unsetLex *shell.Lex
+}
+
+// expand expands the variables of a word like a Dockerfile build does. It
+// returns false if the word refers to an unset variable, whose value is only
+// known when building, such as one from the environment of an image.
+func (cv *dockerfileConverter) expand(word string, vars map[string]string) (string, bool) {
+	value, err := cv.lex.ProcessWordWithMap(word, vars)
+	if err != nil {
+		return "", false
+	}
+
+	unset, err := cv.unsetLex.ProcessWordWithMap(word, vars)
+	if err != nil || unset != value {
+		return "", false
+	}
+	return value, true
+}
+
+// expandWords expands every word like expand, and returns false if any of
+// them can't be expanded.
+func (cv *dockerfileConverter) expandWords(words []string, vars map[string]string) ([]string, bool) {
+	var expanded []string
+	for _, word := range words {
+		value, ok := cv.expand(word, vars)
+		if !ok {
+			return nil, false
+		}
+		expanded = append(expanded, value)
+	}
+	return expanded, true
+}
+
+// setArg sets the value of an ARG instruction in args, which is its default
+// or else the default of the meta ARG with the same name. Arguments without a
+// known value are unset.
+func (cv *dockerfileConverter) setArg(args map[string]string, arg instructions.ArgCommand, vars map[string]string) {
+	delete(args, arg.Key)
+	if arg.Value == nil {
+		if v, ok := cv.metaArgs[arg.Key]; ok {
+			args[arg.Key] = v
+		}
+		return
+	}
+
+	if v, ok := cv.expand(*arg.Value, vars); ok {
+		args[arg.Key] = v
+	}
+}
+
+// stageNames returns the names of the functions that stages are converted
+// to. The last stage is named default, and the other stages are named after
+// their name or index, which are made unique and never a builtin or keyword.
+func stageNames(stages []instructions.Stage) []string {
+	unique := ast.NewNames(report.Keywords, report.ReservedKeywords, report.Debugs, report.Asserts)
+	unique.Reserve("default")
+
+	names := make([]string, len(stages))
+	for i, stage := range stages {
+		switch {
+		case i == len(stages)-1:
+			names[i] = "default"
+		case stage.Name == "":
+			names[i] = unique.Unique(fmt.Sprintf("stage%d", i))
+		default:
+			names[i] = unique.Unique(stage.Name)
+		}
+	}
+	return names
+}
+
+// stageRef returns the index of the stage that a FROM or COPY --from refers
+// to, which can be either the name or the index of an earlier stage.
+func (cv *dockerfileConverter) stageRef(current int, ref string) (int, bool) {
+	if i, ok := instructions.HasStage(cv.stages[:current], strings.ToLower(ref)); ok {
+		return i, true
+	}
+
+	i, err := strconv.Atoi(ref)
+	if err != nil || i < 0 || i >= current {
+		return 0, false
+	}
+	return i, true
+}
+
+// sourceExpr returns a fs block literal of an earlier stage or an image.
+func (cv *dockerfileConverter) sourceExpr(current int, ref string) *ast.Expr {
+	if i, ok := cv.stageRef(current, ref); ok {
+		return ast.NewBlockLitExpr(ast.Filesystem, ast.NewCallStmt(cv.names[i], nil, nil, nil))
+	}
+	return ast.NewBlockLitExpr(ast.Filesystem, ast.NewCallStmt("image", []*ast.Expr{ast.NewStringExpr(ref)}, nil, nil))
+}
+
+func (cv *dockerfileConverter) convertStage(i int, stage instructions.Stage) (*ast.FuncDecl, error) {
+	var stmts []*ast.Stmt
+
+	// Stages have the environment of the stage they are based on, but the
+	// environment of images is unknown until they are resolved.
+	env := make(map[string]string)
+	args := make(map[string]string)
+
+	// Stages based on an image that can't be expanded are converted from
+	// scratch, because a fs function must start with a source.
+	base, expanded := cv.expand(stage.BaseName, cv.metaArgs)
+	if !expanded {
+		base = "scratch"
+	}
+
+	switch j, ok := cv.stageRef(i, base); {
+	case ok:
+		stmts = append(stmts, ast.NewCallStmt(cv.names[j], nil, nil, nil))
+		for k, v := range cv.envs[j] {
+			env[k] = v
+		}
+	case base == "scratch":
+		stmts = append(stmts, ast.NewCallStmt("scratch", nil, nil, nil))
+	default:
+		// Images are resolved so that their environment, working directory
+		// and user are inherited like in a Dockerfile.
+		stmts = append(stmts, ast.NewCallStmt("image", []*ast.Expr{
+			ast.NewStringExpr(base),
+		}, ast.NewWithBlockLit(ast.NewCallStmt("resolve", nil, nil, nil)), nil))
+	}
+
+	if !expanded {
+		stmts = append(stmts, newUnexpandedStmt(fmt.Sprintf("FROM %s", stage.BaseName)))
+	}
+
+	if stage.Platform != "" {
+		stmts = append(stmts, ast.NewCommentStmt(fmt.Sprintf("FROM --platform=%s is not supported", stage.Platform)))
+	}
+
+	shell := []string{"/bin/sh", "-c"}
+	for _, cmd := range stage.Commands {
+		switch c := cmd.(type) {
+		case *instructions.RunCommand:
+			stmts = append(stmts, ast.NewCallStmt("run", ast.NewStringExprs(shellCmdLine(shell, c.ShellDependantCmdLine, true)...), nil, nil))
+		case *instructions.EntrypointCommand:
+			stmts = append(stmts, ast.NewCallStmt("entrypoint", ast.NewStringExprs(shellCmdLine(shell, c.ShellDependantCmdLine, false)...), nil, nil))
+		case *instructions.EnvCommand:
+			// Every variable of an ENV is expanded with the environment from
+			// before it, like in a Dockerfile.
+			vars := stageVars(args, env)
+			for _, kv := range c.Env {
+				value, ok := cv.expand(kv.Value, vars)
+				if !ok {
+					stmts = append(stmts, newUnexpandedStmt(fmt.Sprintf("ENV %s=%s", kv.Key, kv.Value)))
+					delete(env, kv.Key)
+					continue
+				}
+
+				env[kv.Key] = value
+				stmts = append(stmts, ast.NewCallStmt("env", ast.NewStringExprs(kv.Key, value), nil, nil))
+			}
+		case *instructions.ArgCommand:
+			cv.setArg(args, *c, stageVars(args, env))
+			stmts = append(stmts, ast.NewCommentStmt(instructionCode(c)))
+		case *instructions.WorkdirCommand:
+			dir, ok := cv.expand(c.Path, stageVars(args, env))
+			if !ok {
+				stmts = append(stmts, newUnexpandedStmt(instructionCode(c)))
+				continue
+			}
+			stmts = append(stmts, ast.NewCallStmt("dir", ast.NewStringExprs(dir), nil, nil))
+		case *instructions.UserCommand:
+			user, ok := cv.expand(c.User, stageVars(args, env))
+			if !ok {
+				stmts = append(stmts, newUnexpandedStmt(instructionCode(c)))
+				continue
+			}
+			stmts = append(stmts, ast.NewCallStmt("user", ast.NewStringExprs(user), nil, nil))
+		case *instructions.ShellCommand:
+			shell = c.Shell
+		case *instructions.CopyCommand:
+			// The sources, destination and flags are all expanded, so the
+			// instruction is commented out if any of them can't be.
+			words, ok := cv.expandWords(append([]string{c.From, c.Chown}, c.SourcesAndDest...), stageVars(args, env))
+			if !ok {
+				stmts = append(stmts, newUnexpandedStmt(instructionCode(c)))
+				continue
+			}
+			from, chown := words[0], words[1]
+
+			input := ast.NewBlockLitExpr(ast.Filesystem, ast.NewCallStmt("local", ast.NewStringExprs(DockerfileContext), nil, nil))
+			if from != "" {
+				input = cv.sourceExpr(i, from)
+			}
+
+			srcs, dest := splitSourcesAndDest(words[2:])
+			for _, src := range srcs {
+				stmts = append(stmts, newCopyStmt(input, src, dest, chown, false))
+			}
+		case *instructions.AddCommand:
+			words, ok := cv.expandWords(append([]string{c.Chown}, c.SourcesAndDest...), stageVars(args, env))
+			if !ok {
+				stmts = append(stmts, newUnexpandedStmt(instructionCode(c)))
+				continue
+			}
+			chown := words[0]
+
+			srcs, dest := splitSourcesAndDest(words[1:])
+			for _, src := range srcs {
+				if urlRegexp.MatchString(src) {
+					// Like in a Dockerfile, artifacts are not unpacked and are
+					// named after the last element of their URL.
+					input := ast.NewBlockLitExpr(ast.Filesystem, ast.NewCallStmt("http", ast.NewStringExprs(src), nil, nil))
+					stmts = append(stmts, newCopyStmt(input, path.Base(src), dest, chown, false))
+					continue
+				}
+
+				input := ast.NewBlockLitExpr(ast.Filesystem, ast.NewCallStmt("local", ast.NewStringExprs(DockerfileContext), nil, nil))
+				stmts = append(stmts, newCopyStmt(input, src, dest, chown, true))
+			}
+		default:
+			stmts = append(stmts, ast.NewCommentStmt(instructionCode(cmd)))
+		}
+	}
+
+	cv.envs[i] = env
+
+	return &ast.FuncDecl{
+		Type:   ast.NewType(ast.Filesystem),
+		Name:   ast.NewIdent(cv.names[i]),
+		Params: &ast.FieldList{},
+		Body: &ast.BlockStmt{
+			List: stmts,
+		},
+	}, nil
+}
+
+// stageVars returns the variables that words of a stage are expanded with,
+// where the environment takes precedence over build arguments.
+func stageVars(args, env map[string]string) map[string]string {
+	vars := make(map[string]string)
+	for k, v := range args {
+		vars[k] = v
+	}
+	for k, v := range env {
+		vars[k] = v
+	}
+	return vars
+}
+
+// shellCmdLine returns the arguments of a command line, which are run by the
+// shell if the command line was in shell form. A single argument run already
+// runs through /bin/sh, so the default shell is omitted for run.
+func shellCmdLine(shell []string, cmdLine instructions.ShellDependantCmdLine, implicitShell bool) []string {
+	if !cmdLine.PrependShell {
+		return cmdLine.CmdLine
+	}
+
+	line := strings.Join(cmdLine.CmdLine, " ")
+	if implicitShell && len(shell) == 2 && shell[0] == "/bin/sh" && shell[1] == "-c" {
+		return []string{line}
+	}
+	return append(append([]string{}, shell...), line)
+}
+
+// splitSourcesAndDest splits the arguments of a COPY or ADD instruction.
+func splitSourcesAndDest(args []string) ([]string, string) {
+	return args[:len(args)-1], args[len(args)-1]
+}
+
+// newCopyStmt returns a copy with the semantics of a Dockerfile, which copies
+// the contents of directories and creates missing parent directories. The
+// copied files are owned by chown if it is set.
+func newCopyStmt(input *ast.Expr, src, dest, chown string, unpack bool) *ast.Stmt {
+	opts := []*ast.Stmt{
+		ast.NewCallStmt("contentsOnly", nil, nil, nil),
+		ast.NewCallStmt("createDestPath", nil, nil, nil),
+	}
+	if unpack {
+		opts = append(opts, ast.NewCallStmt("unpack", nil, nil, nil))
+	}
+	if chown != "" {
+		opts = append(opts, ast.NewCallStmt("chown", ast.NewStringExprs(chown), nil, nil))
+	}
+	return ast.NewCallStmt("copy", []*ast.Expr{input, ast.NewStringExpr(src), ast.NewStringExpr(dest)}, ast.NewWithBlockLit(opts...), nil)
+}
+
+// instructionCode returns the source of an instruction as it was written.
+func instructionCode(cmd instructions.Command) string {
+	if s, ok := cmd.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return strings.ToUpper(cmd.Name())
+}
+
+// newUnexpandedStmt returns a comment of an instruction with variables that
+// can't be expanded when converting.
+func newUnexpandedStmt(code string) *ast.Stmt {
+	return ast.NewCommentStmt(fmt.Sprintf("%s: variables unknown until building cannot be expanded", code))
+}
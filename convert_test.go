@@ -0,0 +1,299 @@
+package hlb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertDockerfile(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []testCase{{
+		"multi-stage",
+		`
+ARG VERSION=1.0
+FROM golang:1.13 AS build-env
+WORKDIR /src
+COPY . .
+RUN go build -o /out/app ./cmd/app
+
+FROM alpine
+ENV A=1 B=2
+COPY --from=build-env /out/app /usr/bin/app
+ADD https://example.com/config.json /etc/app/
+USER nobody
+EXPOSE 80
+ENTRYPOINT ["app", "serve"]
+`,
+		`
+# ARG VERSION=1.0
+
+fs build_env() {
+	image "golang:1.13" with option {
+		resolve
+	}
+	dir "/src"
+	copy fs {
+		local "."
+	} "." "." with option {
+		contentsOnly
+		createDestPath
+	}
+	run "go build -o /out/app ./cmd/app"
+}
+
+fs default() {
+	image "alpine" with option {
+		resolve
+	}
+	env "A" "1"
+	env "B" "2"
+	copy fs {
+		build_env
+	} "/out/app" "/usr/bin/app" with option {
+		contentsOnly
+		createDestPath
+	}
+	copy fs {
+		http "https://example.com/config.json"
+	} "config.json" "/etc/app/" with option {
+		contentsOnly
+		createDestPath
+	}
+	user "nobody"
+	# EXPOSE 80
+	entrypoint "app" "serve"
+}
+`,
+	}, {
+		"shell",
+		`
+FROM scratch
+SHELL ["/bin/bash", "-c"]
+RUN echo hi
+CMD ["sh"]
+ENTRYPOINT /app --flag
+`,
+		`
+fs default() {
+	scratch
+	run "/bin/bash" "-c" "echo hi"
+	# CMD ["sh"]
+	entrypoint "/bin/bash" "-c" "/app --flag"
+}
+`,
+	}, {
+		"stage index",
+		`
+FROM busybox
+RUN touch /a
+
+FROM scratch
+COPY --from=0 --chown=app:app /a /a
+ADD --chown=1000 vendor.tar.gz /
+`,
+		`
+fs stage0() {
+	image "busybox" with option {
+		resolve
+	}
+	run "touch /a"
+}
+
+fs default() {
+	scratch
+	copy fs {
+		stage0
+	} "/a" "/a" with option {
+		contentsOnly
+		createDestPath
+		chown "app:app"
+	}
+	copy fs {
+		local "."
+	} "vendor.tar.gz" "/" with option {
+		contentsOnly
+		createDestPath
+		unpack
+		chown "1000"
+	}
+}
+`,
+	}, {
+		"variables",
+		`
+ARG BASE
+ARG GO_VERSION=1.13
+FROM golang:${GO_VERSION} AS build
+ENV GOPATH=/go PATH=/go/bin:$PATH
+ENV SRC=$GOPATH/src
+WORKDIR ${SRC}/app
+RUN go build
+
+FROM build
+ARG MODE=release
+WORKDIR $SRC/$MODE
+
+FROM ${BASE}
+WORKDIR $HOME
+
+FROM scratch
+ARG OWNER=app
+ARG STAGE=build
+ENV BIN=/usr/local/bin
+USER $OWNER
+COPY --from=$STAGE --chown=$OWNER:$OWNER /go/bin/app $BIN/
+ADD --chown=${OWNER} https://example.com/$OWNER.tgz ${BIN}
+COPY $UNKNOWN /
+ADD app.tgz $HOME
+USER $UID
+`,
+		`
+# ARG BASE
+# ARG GO_VERSION=1.13
+
+fs build() {
+	image "golang:1.13" with option {
+		resolve
+	}
+	env "GOPATH" "/go"
+	# ENV PATH=/go/bin:$PATH: variables unknown until building cannot be expanded
+	env "SRC" "/go/src"
+	dir "/go/src/app"
+	run "go build"
+}
+
+fs stage1() {
+	build
+	# ARG MODE=release
+	dir "/go/src/release"
+}
+
+fs stage2() {
+	scratch
+	# FROM ${BASE}: variables unknown until building cannot be expanded
+	# WORKDIR $HOME: variables unknown until building cannot be expanded
+}
+
+fs default() {
+	scratch
+	# ARG OWNER=app
+	# ARG STAGE=build
+	env "BIN" "/usr/local/bin"
+	user "app"
+	copy fs {
+		build
+	} "/go/bin/app" "/usr/local/bin/" with option {
+		contentsOnly
+		createDestPath
+		chown "app:app"
+	}
+	copy fs {
+		http "https://example.com/app.tgz"
+	} "app.tgz" "/usr/local/bin" with option {
+		contentsOnly
+		createDestPath
+		chown "app"
+	}
+	# COPY $UNKNOWN /: variables unknown until building cannot be expanded
+	# ADD app.tgz $HOME: variables unknown until building cannot be expanded
+	# USER $UID: variables unknown until building cannot be expanded
+}
+`,
+	}, {
+		"stage names",
+		`
+FROM scratch AS default
+FROM scratch AS a-b
+FROM scratch AS a.b
+FROM scratch AS image
+FROM scratch AS local
+FROM scratch AS with
+FROM busybox AS scratch
+FROM default
+COPY --from=a.b /a /a
+COPY --from=image /b /b
+COPY --from=local /c /c
+COPY --from=with /d /d
+`,
+		`
+fs default_2() {
+	scratch
+}
+
+fs a_b() {
+	scratch
+}
+
+fs a_b_2() {
+	scratch
+}
+
+fs image_2() {
+	scratch
+}
+
+fs local_2() {
+	scratch
+}
+
+fs with_2() {
+	scratch
+}
+
+fs scratch_2() {
+	image "busybox" with option {
+		resolve
+	}
+}
+
+fs default() {
+	default_2
+	copy fs {
+		a_b_2
+	} "/a" "/a" with option {
+		contentsOnly
+		createDestPath
+	}
+	copy fs {
+		image_2
+	} "/b" "/b" with option {
+		contentsOnly
+		createDestPath
+	}
+	copy fs {
+		local_2
+	} "/c" "/c" with option {
+		contentsOnly
+		createDestPath
+	}
+	copy fs {
+		with_2
+	} "/d" "/d" with option {
+		contentsOnly
+		createDestPath
+	}
+}
+`,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			file, err := ConvertDockerfile(strings.NewReader(tc.input))
+			require.NoError(t, err)
+			require.Equal(t, strings.TrimSpace(tc.expected), file.String())
+
+			// The converted file must be a valid HLB program.
+			parsed, ib, err := Parse(strings.NewReader(file.String()))
+			require.NoError(t, err)
+
+			_, err = Check([]*ast.File{parsed}, map[string]*report.IndexedBuffer{parsed.Pos.Filename: ib})
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package hlb
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines around each change in a
+	// unified diff.
+	diffContext = 3
+)
+
+// WriteUnifiedDiff writes a unified diff of the lines that changed from a to
+// b, and returns whether there were any. Nothing is written if a and b are the
+// same.
+func WriteUnifiedDiff(w io.Writer, aName, bName string, a, b []byte) (bool, error) {
+	edits := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	hunks := groupHunks(edits)
+	if len(hunks) == 0 {
+		return false, nil
+	}
+
+	_, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", aName, bName)
+	if err != nil {
+		return true, err
+	}
+
+	for _, hunk := range hunks {
+		err = hunk.write(w)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// splitLines splits text into lines that keep their line endings, so that a
+// last line without one is different from the same line with one.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type edit struct {
+	// kind is ' ' for unchanged lines, '-' for removed lines and '+' for
+	// added lines.
+	kind byte
+	line string
+
+	// aLine and bLine are the number of lines of a and b before this edit.
+	aLine, bLine int
+}
+
+// diffLines returns the edits from a to b using their longest common
+// subsequence. HLB sources are small, so the quadratic table is fine.
+func diffLines(a, b []string) []edit {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var (
+		edits []edit
+		i, j  int
+	)
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+	return edits
+}
+
+type hunk struct {
+	edits []edit
+}
+
+// groupHunks groups changed lines with their surrounding context, merging
+// changes whose context overlaps.
+func groupHunks(edits []edit) []*hunk {
+	var (
+		hunks []*hunk
+		start = -1
+		end   int
+	)
+
+	for i, e := range edits {
+		if e.kind == ' ' {
+			continue
+		}
+
+		lo := i - diffContext
+		if lo < 0 {
+			lo = 0
+		}
+
+		if start >= 0 && lo > end {
+			hunks = append(hunks, &hunk{edits[start:end]})
+			start = -1
+		}
+		if start < 0 {
+			start = lo
+		}
+
+		end = i + diffContext + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+	}
+
+	if start >= 0 {
+		hunks = append(hunks, &hunk{edits[start:end]})
+	}
+	return hunks
+}
+
+func (h *hunk) write(w io.Writer) error {
+	var aLen, bLen int
+	for _, e := range h.edits {
+		if e.kind != '+' {
+			aLen++
+		}
+		if e.kind != '-' {
+			bLen++
+		}
+	}
+
+	// Ranges start at the first line of the hunk, or at the line before it
+	// when the hunk has no lines on that side.
+	aStart, bStart := h.edits[0].aLine, h.edits[0].bLine
+	if aLen > 0 {
+		aStart++
+	}
+	if bLen > 0 {
+		bStart++
+	}
+
+	_, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range h.edits {
+		_, err = fmt.Fprintf(w, "%c%s", e.kind, e.line)
+		if err != nil {
+			return err
+		}
+
+		if !strings.HasSuffix(e.line, "\n") {
+			_, err = io.WriteString(w, "\n\\ No newline at end of file\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package hlb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{
+			"same",
+			"fs foo() { scratch; }\n",
+			"fs foo() { scratch; }\n",
+			"",
+		},
+		{
+			"changed line",
+			"fs foo() {\n    scratch\n}\n",
+			"fs foo() {\n\tscratch\n}\n",
+			"--- a\n+++ b\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				" fs foo() {\n" +
+				"-    scratch\n" +
+				"+\tscratch\n" +
+				" }\n",
+		},
+		{
+			"removed lines",
+			"fs foo() {\n\n\n\tscratch\n}\n",
+			"fs foo() {\n\tscratch\n}\n",
+			"--- a\n+++ b\n" +
+				"@@ -1,5 +1,3 @@\n" +
+				" fs foo() {\n" +
+				"-\n" +
+				"-\n" +
+				" \tscratch\n" +
+				" }\n",
+		},
+		{
+			"separate hunks",
+			"a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n",
+			"A\nb\nc\nd\ne\nf\ng\nh\ni\nJ\n",
+			"--- a\n+++ b\n" +
+				"@@ -1,4 +1,4 @@\n" +
+				"-a\n" +
+				"+A\n" +
+				" b\n" +
+				" c\n" +
+				" d\n" +
+				"@@ -7,4 +7,4 @@\n" +
+				" g\n" +
+				" h\n" +
+				" i\n" +
+				"-j\n" +
+				"+J\n",
+		},
+		{
+			"no newline at end of file",
+			"fs foo() { scratch; }",
+			"fs foo() { scratch; }\n",
+			"--- a\n+++ b\n" +
+				"@@ -1,1 +1,1 @@\n" +
+				"-fs foo() { scratch; }\n" +
+				"\\ No newline at end of file\n" +
+				"+fs foo() { scratch; }\n",
+		},
+		{
+			"empty source",
+			"",
+			"\n",
+			"--- a\n+++ b\n" +
+				"@@ -0,0 +1,1 @@\n" +
+				"+\n",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			changed, err := WriteUnifiedDiff(&buf, "a", "b", []byte(tc.a), []byte(tc.b))
+			require.NoError(t, err)
+			require.Equal(t, tc.expected != "", changed)
+			require.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package hlb
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/openllb/hlb/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []testCase{
+		{
+			"inline block",
+			`
+			fs foo(){scratch;}
+			`,
+			`
+			fs foo() { scratch; }
+			`,
+		},
+		{
+			"mixed indentation",
+			`
+			fs foo() {
+			    scratch
+				  mkdir "a" 0o755
+			}
+			`,
+			`
+			fs foo() {
+				scratch
+				mkdir "a" 0o755
+			}
+			`,
+		},
+		{
+			"blank lines",
+			`
+			fs foo() {
+
+				scratch
+
+
+				mkdir "a" 0o755
+
+			}
+			`,
+			`
+			fs foo() {
+				scratch
+
+				mkdir "a" 0o755
+			}
+			`,
+		},
+		{
+			"declarations",
+			`
+			fs foo() { scratch; }
+			fs bar() { scratch; }
+
+
+
+			fs baz() { scratch; }
+			`,
+			`
+			fs foo() { scratch; }
+
+			fs bar() { scratch; }
+
+			fs baz() { scratch; }
+			`,
+		},
+		{
+			"comments",
+			`
+			# foo is a scratch filesystem.
+			fs foo() {
+			  # empty
+			  scratch # trailing
+			}
+			`,
+			`
+			# foo is a scratch filesystem.
+			fs foo() {
+				# empty
+				scratch # trailing
+			}
+			`,
+		},
+		{
+			"option blocks",
+			`
+			fs foo() {
+				image "alpine" with option {
+				        # always resolve
+				        resolve
+				}
+				run "echo foo" with option {}
+			}
+			`,
+			`
+			fs foo() {
+				image "alpine" with option {
+					# always resolve
+					resolve
+				}
+				run "echo foo"
+			}
+			`,
+		},
+		{
+			"comment only option block",
+			`
+			fs foo() {
+				image "alpine"
+				run "echo foo" with option {
+				# note
+				}
+			}
+			`,
+			`
+			fs foo() {
+				image "alpine"
+				run "echo foo" with option {
+					# note
+				}
+			}
+			`,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			file, _, err := Parse(strings.NewReader(cleanup(tc.input)))
+			require.NoError(t, err)
+			require.Equal(t, cleanup(tc.expected)+"\n", ast.Format(file))
+		})
+	}
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	t.Parallel()
+	for _, tc := range unparseTestCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			for _, input := range []string{tc.input, tc.expected} {
+				formatted := mustFormat(t, cleanup(input))
+				require.Equal(t, formatted, mustFormat(t, formatted))
+			}
+		})
+	}
+}
+
+func TestFormatWhitespace(t *testing.T) {
+	t.Parallel()
+	r := rand.New(rand.NewSource(1))
+	for _, tc := range unparseTestCases {
+		input := cleanup(tc.input)
+		expected := mustFormat(t, input)
+
+		for i := 0; i < 10; i++ {
+			mutated := mutateWhitespace(t, r, input)
+			require.Equal(t, expected, mustFormat(t, mutated), "%s: %q", tc.name, mutated)
+		}
+	}
+}
+
+func mustFormat(t *testing.T, input string) string {
+	file, _, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	return ast.Format(file)
+}
+
+// mutateWhitespace rejoins the tokens of the input with a random amount of
+// spaces and tabs between them, which must not change its formatting.
+func mutateWhitespace(t *testing.T, r *rand.Rand, input string) string {
+	lex, err := ast.Lexer.Lex(strings.NewReader(input))
+	require.NoError(t, err)
+
+	tokens, err := lexer.ConsumeAll(lex)
+	require.NoError(t, err)
+
+	var sb strings.Builder
+	for _, token := range tokens {
+		if token.EOF() {
+			break
+		}
+
+		for n := r.Intn(3) + 1; n > 0; n-- {
+			if r.Intn(2) == 0 {
+				sb.WriteString(" ")
+			} else {
+				sb.WriteString("\t")
+			}
+		}
+		sb.WriteString(token.Value)
+	}
+	return sb.String()
+}
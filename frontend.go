@@ -1,56 +1,171 @@
 package hlb
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 
+	"github.com/containerd/containerd/platforms"
 	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/frontend/gateway/client"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/openllb/hlb/ast"
 	"github.com/openllb/hlb/codegen"
 	"github.com/openllb/hlb/report"
+	"github.com/openllb/hlb/solver"
 )
 
 const (
-	OptTarget                 = "hlb-target"
+	// OptTarget is a comma separated list of targets to build. Building
+	// multiple targets returns a ref named by each target.
+	OptTarget = "hlb-target"
+
+	// OptPlatform is a comma separated list of platforms to build for, such
+	// as "linux/amd64,linux/arm64". Building multiple platforms returns a ref
+	// named by each platform.
+	OptPlatform = "platform"
+
 	SourceHLB                 = "source.hlb"
 	SignatureHLB              = "signature.hlb"
 	FrontendImage             = "openllb/hlb"
 	HLBFileMode   os.FileMode = 0644
+	HLBDirMode    os.FileMode = 0755
+
+	// SourcesDir is the directory that sources are published to, keeping the
+	// layout of the files they were published from.
+	SourcesDir = "sources"
+
+	// StdinSource is the path relative to SourcesDir that a program read from
+	// stdin is published to, so that it is parsed like any other source.
+	StdinSource = "stdin.hlb"
+
+	// LocalContext and LocalDockerfile are the locals that docker build and
+	// buildctl send the build context and the Dockerfile in.
+	LocalContext    = "context"
+	LocalDockerfile = "dockerfile"
+
+	// OptFilename is the name of the program in LocalDockerfile, which docker
+	// build sets from its --file flag.
+	OptFilename = "filename"
 )
 
 func Frontend(ctx context.Context, c client.Client) (*client.Result, error) {
 	opts := c.BuildOpts().Opts
-	target, ok := opts[OptTarget]
-	if !ok {
-		target = "default"
-	} else {
+	targets := []string{"default"}
+	if v, ok := opts[OptTarget]; ok {
+		targets = strings.Split(v, ",")
 		delete(opts, OptTarget)
 	}
 
-	_, err := os.Stat(SourceHLB)
+	ps, err := parsePlatforms(opts[OptPlatform])
 	if err != nil {
 		return nil, err
 	}
 
-	f, err := os.Open(SourceHLB)
+	files, ibs, err := parseSources(ctx, c)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	file, _, err := Parse(f)
+	root, err := Check(files, ibs)
 	if err != nil {
 		return nil, err
 	}
 
-	root, err := report.SemanticCheck(file)
-	if err != nil {
-		return nil, err
+	fc := &frontendCall{c: c, opts: opts}
+	res := client.NewResult()
+
+	var expPlatforms exptypes.Platforms
+	for _, target := range targets {
+		call, err := fc.targetCall(ctx, root, target)
+		if err != nil {
+			return nil, err
+		}
+
+		st, _, err := codegen.Generate(call, root)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range ps {
+			def, err := st.Marshal(llb.Platform(p))
+			if err != nil {
+				return nil, err
+			}
+
+			r, err := c.Solve(ctx, client.SolveRequest{
+				Definition: def.ToPB(),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			ref, err := r.SingleRef()
+			if err != nil {
+				return nil, err
+			}
+
+			config, err := solver.ImageConfig(st, p)
+			if err != nil {
+				return nil, err
+			}
+
+			// A single target for a single platform is the only ref, so that
+			// the result is the same as a build of one definition.
+			var key string
+			switch {
+			case len(targets) > 1 && len(ps) > 1:
+				key = fmt.Sprintf("%s/%s", target, platforms.Format(p))
+			case len(targets) > 1:
+				key = target
+			case len(ps) > 1:
+				key = platforms.Format(p)
+				expPlatforms.Platforms = append(expPlatforms.Platforms, exptypes.Platform{
+					ID:       key,
+					Platform: p,
+				})
+			}
+
+			if key == "" {
+				res.SetRef(ref)
+				res.AddMeta(exptypes.ExporterImageConfigKey, config)
+			} else {
+				res.AddRef(key, ref)
+				res.AddMeta(fmt.Sprintf("%s/%s", exptypes.ExporterImageConfigKey, key), config)
+			}
+		}
 	}
 
+	if len(expPlatforms.Platforms) > 0 {
+		dt, err := json.Marshal(expPlatforms)
+		if err != nil {
+			return nil, err
+		}
+		res.AddMeta(exptypes.ExporterPlatformsKey, dt)
+	}
+
+	return res, nil
+}
+
+// frontendCall builds calls to targets from the opts and inputs of a
+// frontend.
+type frontendCall struct {
+	c      client.Client
+	opts   map[string]string
+	inputs map[string]llb.State
+}
+
+// targetCall returns a call to a target with the args for its params. Inputs
+// for fs params are inserted into the root scope.
+func (fc *frontendCall) targetCall(ctx context.Context, root *ast.AST, target string) (*ast.CallStmt, error) {
 	var params []*ast.Field
 
 	ast.Inspect(root, func(node ast.Node) bool {
@@ -73,7 +188,7 @@ func Frontend(ctx context.Context, c client.Client) (*client.Result, error) {
 		Func: &ast.Ident{Name: target},
 	}
 
-	var inputs map[string]llb.State
+	opts := fc.opts
 	for _, param := range params {
 		name := param.Name.Name
 		switch param.Type.Type() {
@@ -108,17 +223,38 @@ func Frontend(ctx context.Context, c client.Client) (*client.Result, error) {
 			}
 
 			call.Args = append(call.Args, ast.NewBoolExpr(b))
+		case ast.Option:
+			v, ok := opts[name]
+			if !ok {
+				return nil, fmt.Errorf("expected param %q", name)
+			}
+
+			stmts, err := ParseOptionOpt(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid param %q: %s", name, err)
+			}
+
+			call.Args = append(call.Args, ast.NewBlockLitExpr(param.Type.ObjType, stmts...))
 		case ast.Filesystem:
-			if inputs == nil {
-				inputs, err = c.Inputs(ctx)
+			if fc.inputs == nil {
+				var err error
+				fc.inputs, err = fc.c.Inputs(ctx)
 				if err != nil {
-					return nil, err
+					// Clients that send locals instead of inputs may not
+					// support inputs at all.
+					if !isLocal(name) {
+						return nil, err
+					}
+					fc.inputs = make(map[string]llb.State)
 				}
 			}
 
-			st, ok := inputs[name]
+			st, ok := fc.inputs[name]
 			if !ok {
-				return nil, fmt.Errorf("expected input %q", name)
+				if !isLocal(name) {
+					return nil, fmt.Errorf("expected input %q", name)
+				}
+				st = localState(fc.c, name)
 			}
 
 			call.Args = append(call.Args, ast.NewIdentExpr(param.Name.Name))
@@ -131,18 +267,171 @@ func Frontend(ctx context.Context, c client.Client) (*client.Result, error) {
 			})
 		}
 	}
+	return call, nil
+}
 
-	st, _, err := codegen.Generate(call, root)
-	if err != nil {
-		return nil, err
+// parsePlatforms parses the value of OptPlatform, which defaults to
+// linux/amd64.
+func parsePlatforms(v string) ([]specs.Platform, error) {
+	if v == "" {
+		return []specs.Platform{{OS: "linux", Architecture: "amd64"}}, nil
 	}
 
+	var ps []specs.Platform
+	for _, s := range strings.Split(v, ",") {
+		p, err := platforms.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, platforms.Normalize(p))
+	}
+	return ps, nil
+}
+
+// SourcePath returns the path relative to SourcesDir that a source file is
+// published to. Paths outside the working directory lose their leading "..",
+// so different files may be published to the same path.
+func SourcePath(filename string) string {
+	if filename == "<stdin>" {
+		return StdinSource
+	}
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(filename)), "/")
+}
+
+// parseSources parses the sources published to SourcesDir, named by their
+// original paths. Without published sources, the program is read from
+// LocalDockerfile if OptFilename is set, so that it can be built with
+// "# syntax=openllb/hlb". Frontends published before sources kept their
+// layout only have SourceHLB.
+func parseSources(ctx context.Context, c client.Client) ([]*ast.File, map[string]*report.IndexedBuffer, error) {
+	var filenames []string
+	err := filepath.Walk(SourcesDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && filepath.Ext(p) == ".hlb" {
+			filenames = append(filenames, p)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		if filename, ok := c.BuildOpts().Opts[OptFilename]; ok {
+			return parseLocalSource(ctx, c, filename)
+		}
+		filenames = []string{SourceHLB}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var rs []io.Reader
+	for _, filename := range filenames {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+
+		name := filename
+		if rel, err := filepath.Rel(SourcesDir, filename); err == nil && filename != SourceHLB {
+			name = filepath.ToSlash(rel)
+		}
+		rs = append(rs, &namedReader{f, name})
+	}
+
+	return ParseMultiple(rs)
+}
+
+// parseLocalSource parses a program in LocalDockerfile.
+func parseLocalSource(ctx context.Context, c client.Client, filename string) ([]*ast.File, map[string]*report.IndexedBuffer, error) {
+	st := localState(c, LocalDockerfile, llb.FollowPaths([]string{filename}))
+
 	def, err := st.Marshal(llb.LinuxAmd64)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return c.Solve(ctx, client.SolveRequest{
+	res, err := c.Solve(ctx, client.SolveRequest{
 		Definition: def.ToPB(),
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ref, err := res.SingleRef()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dt, err := ref.ReadFile(ctx, client.ReadRequest{
+		Filename: filename,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ParseMultiple([]io.Reader{&namedReader{bytes.NewReader(dt), filename}})
+}
+
+// isLocal returns whether a fs param is filled from a local of the same name
+// when it is not an input.
+func isLocal(name string) bool {
+	return name == LocalContext || name == LocalDockerfile
+}
+
+// localState returns the state of a local sent by the client of the build.
+func localState(c client.Client, name string, opts ...llb.LocalOption) llb.State {
+	opts = append([]llb.LocalOption{
+		llb.SessionID(c.BuildOpts().SessionID),
+		llb.SharedKeyHint(name),
+	}, opts...)
+	return llb.Local(name, opts...)
+}
+
+// OptionCall is a call in an option parameter passed as a frontend opt. The
+// opt is a JSON array of calls, such as:
+//
+//	[{"func": "env", "args": ["KEY", "value"]}, {"func": "readonlyRootfs"}]
+type OptionCall struct {
+	Func string        `json:"func"`
+	Args []interface{} `json:"args,omitempty"`
+}
+
+// ParseOptionOpt parses the JSON value of an option parameter into the
+// statements of an option block.
+func ParseOptionOpt(v string) ([]*ast.Stmt, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(v)))
+	dec.UseNumber()
+
+	var calls []OptionCall
+	err := dec.Decode(&calls)
+	if err != nil {
+		return nil, err
+	}
+
+	var stmts []*ast.Stmt
+	for _, call := range calls {
+		if call.Func == "" {
+			return nil, fmt.Errorf("option call has no func")
+		}
+
+		var args []*ast.Expr
+		for _, arg := range call.Args {
+			switch a := arg.(type) {
+			case string:
+				args = append(args, ast.NewStringExpr(a))
+			case json.Number:
+				i, err := strconv.Atoi(a.String())
+				if err != nil {
+					return nil, fmt.Errorf("arg of %s is not an int: %s", call.Func, a)
+				}
+				args = append(args, ast.NewDecimalExpr(i))
+			case bool:
+				args = append(args, ast.NewBoolExpr(a))
+			default:
+				return nil, fmt.Errorf("arg of %s must be a string, int or bool, found %v", call.Func, arg)
+			}
+		}
+		stmts = append(stmts, ast.NewCallStmt(call.Func, args, nil, nil))
+	}
+	return stmts, nil
 }
@@ -0,0 +1,84 @@
+package hlb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptionOpt(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name     string
+		input    string
+		expected []string
+		err      bool
+	}{{
+		"empty",
+		`[]`,
+		nil,
+		false,
+	}, {
+		"calls",
+		`[{"func": "env", "args": ["KEY", "value"]}, {"func": "readonlyRootfs"}]`,
+		[]string{`env "KEY" "value"`, `readonlyRootfs`},
+		false,
+	}, {
+		"int and bool args",
+		`[{"func": "chmod", "args": [493]}, {"func": "createParents", "args": [false]}]`,
+		[]string{`chmod 493`, `createParents false`},
+		false,
+	}, {
+		"no func",
+		`[{"args": ["value"]}]`,
+		nil,
+		true,
+	}, {
+		"float arg",
+		`[{"func": "chmod", "args": [1.5]}]`,
+		nil,
+		true,
+	}, {
+		"object arg",
+		`[{"func": "env", "args": [{}]}]`,
+		nil,
+		true,
+	}, {
+		"not json",
+		`env "KEY" "value"`,
+		nil,
+		true,
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			stmts, err := ParseOptionOpt(tc.input)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var actual []string
+			for _, stmt := range stmts {
+				actual = append(actual, stmt.Call.String())
+			}
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestSourcePath(t *testing.T) {
+	t.Parallel()
+
+	for filename, expected := range map[string]string{
+		"build.hlb":        "build.hlb",
+		"./examples/a.hlb": "examples/a.hlb",
+		"../other/b.hlb":   "other/b.hlb",
+		"/abs/path/c.hlb":  "abs/path/c.hlb",
+		"<stdin>":          "stdin.hlb",
+	} {
+		require.Equal(t, expected, SourcePath(filename), filename)
+	}
+}
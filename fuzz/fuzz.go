@@ -0,0 +1,118 @@
+// Package fuzz has go-fuzz harnesses for parsing, unparsing and generating
+// code from HLB sources.
+//
+// Build and run a harness with go-fuzz, seeding its corpus from the examples
+// and test tables first:
+//
+//	go test ./fuzz -corpus workdir/corpus
+//	go-fuzz-build -func FuzzUnparse github.com/openllb/hlb/fuzz
+//	go-fuzz -bin fuzz-fuzz.zip -workdir workdir
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/codegen"
+)
+
+// FuzzParse checks that parsing never panics.
+func FuzzParse(data []byte) int {
+	_, _, err := hlb.Parse(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// FuzzUnparse checks that parsing an unparsed file results in the same file,
+// ignoring its layout and comments.
+func FuzzUnparse(data []byte) int {
+	file, _, err := hlb.Parse(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+
+	unparsed := file.String()
+	reparsed, _, err := hlb.Parse(strings.NewReader(unparsed))
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse unparsed file: %s\n%s", err, unparsed))
+	}
+
+	expected, actual := structure(file), structure(reparsed)
+	if expected != actual {
+		panic(fmt.Sprintf("unparsed file has a different structure:\n%s\n%s", expected, actual))
+	}
+	return 1
+}
+
+// FuzzCodegen checks that semantically checking a file and generating its
+// targets either succeeds or returns an error.
+func FuzzCodegen(data []byte) int {
+	// Resolving images needs a registry.
+	if bytes.Contains(data, []byte("resolve")) {
+		return -1
+	}
+
+	files, ibs, err := hlb.ParseMultiple([]io.Reader{bytes.NewReader(data)})
+	if err != nil {
+		return 0
+	}
+
+	root, err := hlb.Check(files, ibs)
+	if err != nil {
+		return 0
+	}
+
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fun := decl.Func
+			if fun == nil || fun.Type.Type() != ast.Filesystem || fun.Params.NumFields() > 0 {
+				continue
+			}
+
+			call := ast.NewCallStmt(fun.Name.Name, nil, nil, nil).Call
+			_, _, _ = codegen.Generate(call, root)
+		}
+	}
+	return 1
+}
+
+// structure returns the nodes of an AST without their positions, newlines
+// and comments, which unparsing may change.
+func structure(node ast.Node) string {
+	var b strings.Builder
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case nil:
+			b.WriteString(")")
+			return false
+		case *ast.Decl:
+			if n.Func == nil {
+				return false
+			}
+		case *ast.Stmt:
+			if n.Call == nil {
+				return false
+			}
+		case *ast.Newline, *ast.StmtEnd, *ast.CommentGroup, *ast.Comment:
+			return false
+		}
+
+		fmt.Fprintf(&b, "(%T", n)
+		switch n := n.(type) {
+		case *ast.Ident:
+			fmt.Fprintf(&b, " %s", n.Name)
+		case *ast.Type:
+			fmt.Fprintf(&b, " %s", n.ObjType)
+		case *ast.BasicLit:
+			fmt.Fprintf(&b, " %s", n)
+		}
+		return true
+	})
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package fuzz
+
+import (
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var corpus = flag.String("corpus", "", "directory to write the seed corpus to")
+
+// TestSeeds runs every harness over the seeds, and writes them to a go-fuzz
+// corpus if one is given.
+func TestSeeds(t *testing.T) {
+	seeds := loadSeeds(t)
+	require.NotEmpty(t, seeds)
+
+	for _, name := range sortedNames(seeds) {
+		data := seeds[name]
+		for harness, fuzz := range map[string]func([]byte) int{
+			"FuzzParse":   FuzzParse,
+			"FuzzUnparse": FuzzUnparse,
+			"FuzzCodegen": FuzzCodegen,
+		} {
+			require.NotPanics(t, func() {
+				fuzz(data)
+			}, "%s on %s", harness, name)
+		}
+	}
+
+	if *corpus == "" {
+		return
+	}
+
+	err := os.MkdirAll(*corpus, 0755)
+	require.NoError(t, err)
+
+	for _, data := range seeds {
+		name := fmt.Sprintf("%x", sha1.Sum(data))
+		err = ioutil.WriteFile(filepath.Join(*corpus, name), data, 0644)
+		require.NoError(t, err)
+	}
+}
+
+// loadSeeds returns the examples, the language reference and the inputs of
+// the syntax error test tables.
+func loadSeeds(t *testing.T) map[string][]byte {
+	seeds := make(map[string][]byte)
+
+	matches, err := filepath.Glob("../examples/*.hlb")
+	require.NoError(t, err)
+
+	for _, filename := range append(matches, "../language/reference.hlb") {
+		data, err := ioutil.ReadFile(filename)
+		require.NoError(t, err)
+		seeds[filename] = data
+	}
+
+	for name, input := range testCaseInputs(t, "../report/errors_test.go") {
+		seeds[name] = []byte(input)
+	}
+	return seeds
+}
+
+// testCaseInputs returns the inputs of the testCase tables in a test file,
+// which are the second field of each test case.
+func testCaseInputs(t *testing.T, filename string) map[string]string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, 0)
+	require.NoError(t, err)
+
+	inputs := make(map[string]string)
+	goast.Inspect(f, func(n goast.Node) bool {
+		lit, ok := n.(*goast.CompositeLit)
+		if !ok {
+			return true
+		}
+
+		typ, ok := lit.Type.(*goast.ArrayType)
+		if !ok {
+			return true
+		}
+
+		elt, ok := typ.Elt.(*goast.Ident)
+		if !ok || elt.Name != "testCase" {
+			return true
+		}
+
+		for _, e := range lit.Elts {
+			tc, ok := e.(*goast.CompositeLit)
+			if !ok || len(tc.Elts) < 2 {
+				continue
+			}
+
+			input, ok := tc.Elts[1].(*goast.BasicLit)
+			if !ok || input.Kind != token.STRING {
+				continue
+			}
+
+			value, err := strconv.Unquote(input.Value)
+			require.NoError(t, err)
+
+			inputs[fset.Position(input.Pos()).String()] = value
+		}
+		return false
+	})
+	return inputs
+}
+
+func sortedNames(seeds map[string][]byte) []string {
+	var names []string
+	for name := range seeds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
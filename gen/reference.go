@@ -236,6 +236,54 @@ var (
 						Name:   "scratch",
 					},
 
+					"assertContent": &Func{
+						Doc:    "Asserts that a file in the current filesystem has exactly the given contents.",
+						Type:   "fs",
+						Method: true,
+						Name:   "assertContent",
+						Params: []Field{
+							{
+								Doc:      "the path of the file.",
+								Variadic: false,
+								Type:     "string",
+								Name:     "path",
+							},
+							{
+								Doc:      "the expected contents of the file.",
+								Variadic: false,
+								Type:     "string",
+								Name:     "content",
+							},
+						},
+					},
+					"assertExists": &Func{
+						Doc:    "Asserts that a file exists in the current filesystem. Assertions are checked\nby `hlb test` and never change the filesystem.",
+						Type:   "fs",
+						Method: true,
+						Name:   "assertExists",
+						Params: []Field{
+							{
+								Doc:      "the path of the file.",
+								Variadic: false,
+								Type:     "string",
+								Name:     "path",
+							},
+						},
+					},
+					"assertRun": &Func{
+						Doc:    "Asserts that a command exits zero when executed in the current filesystem.\nThe command is parsed the same as `run`, and the changes it makes are\ndiscarded.",
+						Type:   "fs",
+						Method: true,
+						Name:   "assertRun",
+						Params: []Field{
+							{
+								Doc:      "the command to execute.",
+								Variadic: true,
+								Type:     "string",
+								Name:     "arg",
+							},
+						},
+					},
 					"copy": &Func{
 						Doc:    "Copies a file from an input filesystem into the current filesystem.",
 						Type:   "fs",
@@ -262,6 +310,20 @@ var (
 							},
 						},
 						Options: []*Func{
+							{
+								Doc:    "Change the owner of the copied files.",
+								Type:   "option::copy",
+								Method: false,
+								Name:   "chown",
+								Params: []Field{
+									{
+										Doc:      "the user:group owner of the copied files.",
+										Variadic: false,
+										Type:     "string",
+										Name:     "owner",
+									},
+								},
+							},
 							{
 								Doc:    "If the `src` path is a directory, only the contents of the directory is\ncopied to the destination.",
 								Type:   "option::copy",
@@ -274,6 +336,20 @@ var (
 								Method: false,
 								Name:   "createDestPath",
 							},
+							{
+								Doc:    "Sets the created time of the copied files.",
+								Type:   "option::copy",
+								Method: false,
+								Name:   "createdTime",
+								Params: []Field{
+									{
+										Doc:      "the created time in the RFC3339 format.",
+										Variadic: false,
+										Type:     "string",
+										Name:     "created",
+									},
+								},
+							},
 							{
 								Doc:    "Follow symlinks in the input filesystem and copy the symlink targets too.",
 								Type:   "option::copy",
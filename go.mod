@@ -5,6 +5,8 @@ go 1.12
 require (
 	github.com/alecthomas/participle v0.4.2-0.20191230055107-1fbf95471489
 	github.com/containerd/console v0.0.0-20181022165439-0650fd9eeb50
+	github.com/containerd/containerd v1.4.0-0.20191014053712-acdcf13d5eaf
+	github.com/docker/distribution v2.7.1-0.20190205005809-0d3efadf0154+incompatible
 	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51
 	github.com/kr/pretty v0.2.0 // indirect
 	github.com/logrusorgru/aurora v0.0.0-20191116043053-66b7ad493a23
@@ -14,6 +16,7 @@ require (
 	github.com/opencontainers/image-spec v1.0.1
 	github.com/openllb/doxygen-parser v0.0.0-20200128221307-2aa2d8be1c35
 	github.com/stretchr/testify v1.4.0
+	github.com/tonistiigi/fsutil v0.0.0-20191018213012-0f039a052ca1
 	github.com/urfave/cli/v2 v2.1.1
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 )
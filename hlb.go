@@ -3,42 +3,184 @@ package hlb
 import (
 	"bufio"
 	"context"
+	"crypto/ecdsa"
+	"fmt"
 	"io"
 	"os"
 
-	"github.com/moby/buildkit/client"
 	isatty "github.com/mattn/go-isatty"
+	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
 	"github.com/openllb/hlb/ast"
 	"github.com/openllb/hlb/codegen"
-	"github.com/openllb/hlb/report"
 )
 
-func Compile(ctx context.Context, cln *client.Client, target string, rs []io.Reader, debug bool) (llb.State, *codegen.CodeGenInfo, error) {
+type CompileOption func(*CompileInfo) error
+
+type CompileInfo struct {
+	Debug       bool
+	DebugRecord io.Writer
+	DebugScript *codegen.Script
+	TrustedKeys []*ecdsa.PublicKey
+	Lock        *codegen.Lock
+	Locked      bool
+	VendorDir   string
+}
+
+// WithDebug compiles using an interactive debugger reading from stdin.
+func WithDebug(debug bool) CompileOption {
+	return func(i *CompileInfo) error {
+		i.Debug = debug
+		return nil
+	}
+}
+
+// WithDebugRecord records every debugger step and writes the session to w
+// after compilation, even if compilation fails.
+func WithDebugRecord(w io.Writer) CompileOption {
+	return func(i *CompileInfo) error {
+		i.DebugRecord = w
+		return nil
+	}
+}
+
+// WithDebugScript compiles using a debugger driven by a command file. The
+// compilation fails if the debugger output does not match the expectations in
+// the script.
+func WithDebugScript(script *codegen.Script) CompileOption {
+	return func(i *CompileInfo) error {
+		i.DebugScript = script
+		return nil
+	}
+}
+
+// WithTrustedKeys verifies that every generated frontend was signed by one of
+// the keys before compiling.
+func WithTrustedKeys(keys []*ecdsa.PublicKey) CompileOption {
+	return func(i *CompileInfo) error {
+		i.TrustedKeys = keys
+		return nil
+	}
+}
+
+// WithLock compiles with remote sources substituted by their locked values.
+// If locked is true, sources missing from the lock are errors.
+func WithLock(lock *codegen.Lock, locked bool) CompileOption {
+	return func(i *CompileInfo) error {
+		i.Lock = lock
+		i.Locked = locked
+		return nil
+	}
+}
+
+// WithOffline compiles with remote sources replaced by their copies vendored
+// to a directory.
+func WithOffline(vendorDir string) CompileOption {
+	return func(i *CompileInfo) error {
+		i.VendorDir = vendorDir
+		return nil
+	}
+}
+
+func Compile(ctx context.Context, cln *client.Client, target string, rs []io.Reader, opts ...CompileOption) (llb.State, *codegen.CodeGenInfo, error) {
 	st := llb.Scratch()
 
+	var info CompileInfo
+	for _, opt := range opts {
+		err := opt(&info)
+		if err != nil {
+			return st, nil, err
+		}
+	}
+
 	files, ibs, err := ParseMultiple(rs, defaultOpts()...)
 	if err != nil {
 		return st, nil, err
 	}
 
-	root, err := report.SemanticCheck(files...)
+	root, err := Check(files, ibs, defaultOpts()...)
 	if err != nil {
 		return st, nil, err
 	}
 
+	if info.TrustedKeys != nil {
+		refs, err := FrontendRefs(root)
+		if err != nil {
+			return st, nil, err
+		}
+
+		// Frontends are verified by digest and generated by the verified
+		// digest, so that a tag pushed after verification is never generated.
+		// Locked frontends are verified at their locked digest.
+		pinned := make(map[string]string)
+		for _, ref := range refs {
+			var ok bool
+			if info.Lock != nil {
+				pinned[ref], ok = info.Lock.Get(codegen.SourceImage, ref)
+			}
+
+			if !ok {
+				if info.Locked {
+					return st, nil, fmt.Errorf("frontend %s is not locked", ref)
+				}
+
+				pinned[ref], err = ResolveImage(ctx, ref)
+				if err != nil {
+					return st, nil, fmt.Errorf("failed to resolve frontend %s: %s", ref, err)
+				}
+			}
+
+			err = VerifyFrontend(ctx, cln, pinned[ref], info.TrustedKeys)
+			if err != nil {
+				return st, nil, err
+			}
+		}
+
+		err = PinFrontends(root, pinned)
+		if err != nil {
+			return st, nil, err
+		}
+	}
+
 	call := &ast.CallStmt{
 		Func: &ast.Ident{Name: target},
 	}
 
-	var opts []codegen.CodeGenOption
-	if debug {
+	locals := make(map[string]string)
+	dbgr := codegen.NewNoopDebugger()
+	switch {
+	case info.DebugScript != nil:
+		r := bufio.NewReader(info.DebugScript)
+
+		dbgr = codegen.NewDebugger(ctx, cln, info.DebugScript, r, ibs, locals)
+	case info.Debug:
 		r := bufio.NewReader(os.Stdin)
 
-		opts = append(opts, codegen.WithDebugger(codegen.NewDebugger(ctx, cln, os.Stderr, r, ibs)))
+		dbgr = codegen.NewDebugger(ctx, cln, os.Stderr, r, ibs, locals)
 	}
 
-	return codegen.Generate(call, root, opts...)
+	var rec *codegen.Recording
+	if info.DebugRecord != nil {
+		rec = codegen.NewRecording(ibs)
+		dbgr = rec.Record(dbgr)
+	}
+
+	st, genInfo, err := codegen.Generate(call, root,
+		codegen.WithDebugger(dbgr),
+		codegen.WithLocals(locals),
+		codegen.WithLock(info.Lock, info.Locked),
+		codegen.WithOffline(info.VendorDir),
+	)
+	if rec != nil {
+		recErr := rec.Encode(info.DebugRecord)
+		if err == nil {
+			err = recErr
+		}
+	}
+	if info.DebugScript != nil && err == nil {
+		err = info.DebugScript.Err()
+	}
+	return st, genInfo, err
 }
 
 func defaultOpts() []ParseOption {
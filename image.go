@@ -0,0 +1,41 @@
+package hlb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/client/llb/imagemetaresolver"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ResolveImage returns the ref of an image pinned to its current digest. Refs
+// that already have a digest are returned as is.
+func ResolveImage(ctx context.Context, ref string) (string, error) {
+	if strings.Contains(ref, "@") {
+		return ref, nil
+	}
+
+	dgst, _, err := imagemetaresolver.Default().ResolveImageConfig(ctx, ref, llb.ResolveImageConfigOpt{})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s@%s", ref, dgst), nil
+}
+
+// ImageConfig returns the config of an image.
+func ImageConfig(ctx context.Context, ref string) (*specs.Image, error) {
+	_, dt, err := imagemetaresolver.Default().ResolveImageConfig(ctx, ref, llb.ResolveImageConfigOpt{})
+	if err != nil {
+		return nil, err
+	}
+
+	var img specs.Image
+	err = json.Unmarshal(dt, &img)
+	if err != nil {
+		return nil, err
+	}
+	return &img, nil
+}
@@ -0,0 +1,186 @@
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/openllb/hlb/ast"
+)
+
+const (
+	// SuppressDirective is the comment that suppresses diagnostics on its own
+	// line, or on the next line if the comment is on a line of its own. It
+	// suppresses every rule unless followed by a colon and a comma separated
+	// list of rule names, like "# nolint:network-host,security-insecure".
+	SuppressDirective = "nolint"
+)
+
+// Rule is a check for bad practice that is not a semantic error.
+type Rule struct {
+	// Name identifies the rule in diagnostics and suppression comments.
+	Name string
+
+	// Description is a one line explanation of what the rule checks.
+	Description string
+
+	// Run reports the diagnostics of the rule for a semantically checked AST.
+	Run func(pass *Pass)
+}
+
+// Pass is the state of running a single rule.
+type Pass struct {
+	Root *ast.AST
+
+	rule        *Rule
+	diagnostics []*Diagnostic
+}
+
+// Reportf reports a diagnostic at the position of a node.
+func (p *Pass) Reportf(node ast.Node, format string, a ...interface{}) {
+	p.diagnostics = append(p.diagnostics, &Diagnostic{
+		Rule:    p.rule.Name,
+		Pos:     node.Position(),
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// Diagnostic is a warning reported by a rule.
+type Diagnostic struct {
+	Rule    string
+	Pos     lexer.Position
+	Message string
+}
+
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", d.Pos.Filename, d.Pos.Line, d.Pos.Column, d.Message, d.Rule)
+}
+
+// Lint runs the rules over a semantically checked AST and returns their
+// diagnostics sorted by position, without the ones that are suppressed.
+func Lint(root *ast.AST, rules []*Rule) []*Diagnostic {
+	suppressed := suppressions(root)
+
+	var diagnostics []*Diagnostic
+	for _, rule := range rules {
+		pass := &Pass{
+			Root: root,
+			rule: rule,
+		}
+		rule.Run(pass)
+
+		for _, d := range pass.diagnostics {
+			if suppressed.match(d) {
+				continue
+			}
+			diagnostics = append(diagnostics, d)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		pi, pj := diagnostics[i].Pos, diagnostics[j].Pos
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		if pi.Offset != pj.Offset {
+			return pi.Offset < pj.Offset
+		}
+		return diagnostics[i].Rule < diagnostics[j].Rule
+	})
+	return diagnostics
+}
+
+// FindRules returns the rules with the given names.
+func FindRules(rules []*Rule, names ...string) ([]*Rule, error) {
+	byName := make(map[string]*Rule)
+	for _, rule := range rules {
+		byName[rule.Name] = rule
+	}
+
+	var found []*Rule
+	for _, name := range names {
+		rule, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown lint rule %q", name)
+		}
+		found = append(found, rule)
+	}
+	return found, nil
+}
+
+type lineKey struct {
+	filename string
+	line     int
+}
+
+// suppressionSet maps lines to the rules suppressed on them, where a nil
+// slice of rules suppresses every rule.
+type suppressionSet map[lineKey][]string
+
+func suppressions(root *ast.AST) suppressionSet {
+	set := make(suppressionSet)
+	ast.Inspect(root, func(node ast.Node) bool {
+		comment, ok := node.(*ast.Comment)
+		if !ok {
+			return true
+		}
+
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "#"))
+		if !strings.HasPrefix(text, SuppressDirective) {
+			return true
+		}
+		text = strings.TrimPrefix(text, SuppressDirective)
+
+		var rules []string
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, ":"):
+			fields := strings.Fields(strings.TrimPrefix(text, ":"))
+			if len(fields) == 0 {
+				return true
+			}
+
+			for _, name := range strings.Split(fields[0], ",") {
+				if name != "" {
+					rules = append(rules, name)
+				}
+			}
+			if len(rules) == 0 {
+				return true
+			}
+		case text[0] == ' ' || text[0] == '\t':
+			// Anything after whitespace is an explanation.
+		default:
+			return true
+		}
+
+		for _, line := range []int{comment.Pos.Line, comment.Pos.Line + 1} {
+			key := lineKey{comment.Pos.Filename, line}
+			if rules == nil {
+				set[key] = nil
+			} else if existing, ok := set[key]; !ok || existing != nil {
+				set[key] = append(existing, rules...)
+			}
+		}
+		return true
+	})
+	return set
+}
+
+func (s suppressionSet) match(d *Diagnostic) bool {
+	rules, ok := s[lineKey{d.Pos.Filename, d.Pos.Line}]
+	if !ok {
+		return false
+	}
+	if rules == nil {
+		return true
+	}
+
+	for _, rule := range rules {
+		if rule == d.Rule {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/openllb/hlb"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+)
+
+var source = `
+fs default() {
+	image "alpine"
+	run "make" with option {
+		mount fs { scratch; } "/out"
+		network "host"
+		security "insecure" # nolint:security-insecure
+	}
+}
+
+fs build(fs src, string unused) {
+	image "alpine:3.11"
+	run "make" with option {
+		readonlyRootfs
+		mount src "/src" with option {
+			readonly
+		}
+		mount fs { scratch; } "/out" as buildOutput
+	}
+}
+
+fs ignored() {
+	# nolint:local-unfiltered
+	local "."
+}
+
+fs context() {
+	local "." with option {
+		includePatterns "*.hlb"
+	}
+}
+
+fs unfiltered() {
+	local "./"
+}
+
+string unusedString() {
+	value "foo"
+}
+
+fs insecure() {
+	image "alpine:3.11"
+	run "make" with option {
+		security "insecure"
+	}
+}
+`
+
+func parse(t *testing.T, input string) *ast.AST {
+	file, _, err := hlb.Parse(strings.NewReader(input))
+	require.NoError(t, err)
+
+	root, err := report.SemanticCheck(file)
+	require.NoError(t, err)
+	return root
+}
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+	root := parse(t, source)
+
+	var actual []string
+	for _, d := range Lint(root, DefaultRules) {
+		actual = append(actual, fmt.Sprintf("%d %s", d.Pos.Line, d.Rule))
+	}
+
+	require.Equal(t, []string{
+		"3 image-unpinned",
+		"4 run-writable-rootfs",
+		"6 network-host",
+		"11 unused-function",
+		"11 unused-parameter",
+		"18 unused-alias",
+		"34 local-unfiltered",
+		"37 unused-function",
+		"44 security-insecure",
+	}, actual)
+}
+
+func TestFindRules(t *testing.T) {
+	t.Parallel()
+	rules, err := FindRules(DefaultRules, "network-host")
+	require.NoError(t, err)
+	require.Equal(t, []*Rule{NetworkHost}, rules)
+
+	_, err = FindRules(DefaultRules, "unknown")
+	require.Error(t, err)
+}
+
+func TestWriteSARIF(t *testing.T) {
+	t.Parallel()
+	root := parse(t, source)
+
+	rules := []*Rule{ImageUnpinned}
+
+	var buf bytes.Buffer
+	err := WriteSARIF(&buf, rules, Lint(root, rules))
+	require.NoError(t, err)
+
+	var log report.SARIFLog
+	err = json.Unmarshal(buf.Bytes(), &log)
+	require.NoError(t, err)
+
+	require.Equal(t, report.SARIFVersion, log.Version)
+	require.Len(t, log.Runs, 1)
+	require.Len(t, log.Runs[0].Tool.Driver.Rules, 1)
+	require.Len(t, log.Runs[0].Results, 1)
+
+	result := log.Runs[0].Results[0]
+	require.Equal(t, "image-unpinned", result.RuleID)
+	require.Equal(t, 3, result.Locations[0].PhysicalLocation.Region.StartLine)
+}
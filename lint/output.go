@@ -0,0 +1,71 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/openllb/hlb/report"
+)
+
+// WriteText writes a diagnostic per line.
+func WriteText(w io.Writer, diagnostics []*Diagnostic) error {
+	for _, d := range diagnostics {
+		_, err := fmt.Fprintln(w, d)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonDiagnostic struct {
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// WriteJSON writes diagnostics as a JSON array.
+func WriteJSON(w io.Writer, diagnostics []*Diagnostic) error {
+	jds := []*jsonDiagnostic{}
+	for _, d := range diagnostics {
+		jds = append(jds, &jsonDiagnostic{
+			Rule:     d.Rule,
+			Message:  d.Message,
+			Filename: d.Pos.Filename,
+			Line:     d.Pos.Line,
+			Column:   d.Pos.Column,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jds)
+}
+
+// WriteSARIF writes diagnostics as a SARIF log whose tool describes the rules
+// that were run.
+func WriteSARIF(w io.Writer, rules []*Rule, diagnostics []*Diagnostic) error {
+	log := report.NewSARIFLog("hlb lint")
+
+	run := log.Runs[0]
+	for _, rule := range rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, &report.SARIFRule{
+			ID:               rule.Name,
+			ShortDescription: report.SARIFMessage{Text: rule.Description},
+		})
+	}
+
+	for _, d := range diagnostics {
+		run.Results = append(run.Results, &report.SARIFResult{
+			RuleID:    d.Rule,
+			Level:     "warning",
+			Message:   report.SARIFMessage{Text: d.Message},
+			Locations: []*report.SARIFLocation{report.NewSARIFLocation(d.Pos)},
+		})
+	}
+
+	return log.Encode(w)
+}
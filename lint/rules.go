@@ -0,0 +1,292 @@
+package lint
+
+import (
+	"path"
+	"strings"
+
+	"github.com/openllb/hlb/ast"
+)
+
+var (
+	ImageUnpinned = &Rule{
+		Name:        "image-unpinned",
+		Description: "image references should have a tag or digest",
+		Run:         runImageUnpinned,
+	}
+
+	RunWritableRootfs = &Rule{
+		Name:        "run-writable-rootfs",
+		Description: "run statements writing to mounts should use readonlyRootfs",
+		Run:         runRunWritableRootfs,
+	}
+
+	SecurityInsecure = &Rule{
+		Name:        "security-insecure",
+		Description: "run statements should not use security insecure",
+		Run:         runSecurityInsecure,
+	}
+
+	NetworkHost = &Rule{
+		Name:        "network-host",
+		Description: "run statements should not use network host",
+		Run:         runNetworkHost,
+	}
+
+	LocalUnfiltered = &Rule{
+		Name:        "local-unfiltered",
+		Description: "local sources of the working directory should use includePatterns",
+		Run:         runLocalUnfiltered,
+	}
+
+	UnusedFunction = &Rule{
+		Name:        "unused-function",
+		Description: "functions that cannot be targets should be used",
+		Run:         runUnusedFunction,
+	}
+
+	UnusedAlias = &Rule{
+		Name:        "unused-alias",
+		Description: "aliases that cannot be targets should be used",
+		Run:         runUnusedAlias,
+	}
+
+	UnusedParameter = &Rule{
+		Name:        "unused-parameter",
+		Description: "function parameters should be used",
+		Run:         runUnusedParameter,
+	}
+
+	// DefaultRules are the rules run by hlb lint.
+	DefaultRules = []*Rule{
+		ImageUnpinned,
+		RunWritableRootfs,
+		SecurityInsecure,
+		NetworkHost,
+		LocalUnfiltered,
+		UnusedFunction,
+		UnusedAlias,
+		UnusedParameter,
+	}
+)
+
+func runImageUnpinned(pass *Pass) {
+	inspectCalls(pass.Root, "image", func(call *ast.CallStmt) {
+		ref, ok := stringArg(call, 0)
+		if !ok {
+			return
+		}
+
+		if strings.Contains(ref, "@") {
+			return
+		}
+
+		// A colon in the last path component is a tag, otherwise it is the
+		// port of a registry.
+		if strings.Contains(path.Base(ref), ":") {
+			return
+		}
+
+		pass.Reportf(call, "image %q has no tag or digest", ref)
+	})
+}
+
+func runRunWritableRootfs(pass *Pass) {
+	inspectCalls(pass.Root, "run", func(call *ast.CallStmt) {
+		opts := optionCalls(call)
+		if hasCall(opts, "readonlyRootfs") {
+			return
+		}
+
+		for _, opt := range opts {
+			if opt.Func.Name != "mount" {
+				continue
+			}
+
+			mountOpts := optionCalls(opt)
+			if hasCall(mountOpts, "readonly") || hasCall(mountOpts, "tmpfs") {
+				continue
+			}
+
+			pass.Reportf(call, "run writes to a mount but its root filesystem is writable, consider readonlyRootfs")
+			return
+		}
+	})
+}
+
+func runSecurityInsecure(pass *Pass) {
+	inspectCalls(pass.Root, "security", func(call *ast.CallStmt) {
+		if mode, _ := stringArg(call, 0); mode == "insecure" {
+			pass.Reportf(call, "security insecure gives run full access to the host")
+		}
+	})
+}
+
+func runNetworkHost(pass *Pass) {
+	inspectCalls(pass.Root, "network", func(call *ast.CallStmt) {
+		if mode, _ := stringArg(call, 0); mode == "host" {
+			pass.Reportf(call, "network host shares the network namespace of the host")
+		}
+	})
+}
+
+func runLocalUnfiltered(pass *Pass) {
+	inspectCalls(pass.Root, "local", func(call *ast.CallStmt) {
+		dir, ok := stringArg(call, 0)
+		if !ok || path.Clean(dir) != "." {
+			return
+		}
+
+		// Option functions cannot be checked without evaluating them.
+		if call.WithOpt != nil && call.WithOpt.Ident != nil {
+			return
+		}
+
+		if hasCall(optionCalls(call), "includePatterns") {
+			return
+		}
+
+		pass.Reportf(call, "local %q sends the entire directory, consider includePatterns", dir)
+	})
+}
+
+func runUnusedFunction(pass *Pass) {
+	refs := references(pass.Root)
+	for _, fun := range funcDecls(pass.Root) {
+		if isTarget(fun) || refs[fun.Name.Name] {
+			continue
+		}
+		pass.Reportf(fun.Name, "function %s is unused", fun.Name)
+	}
+}
+
+func runUnusedAlias(pass *Pass) {
+	refs := references(pass.Root)
+	for _, fun := range funcDecls(pass.Root) {
+		ast.Inspect(fun, func(node ast.Node) bool {
+			alias, ok := node.(*ast.AliasDecl)
+			if !ok || alias.Ident == nil {
+				return true
+			}
+
+			// Aliases are targets like their function, but local aliases are
+			// only visible inside it.
+			if alias.Local == nil && isTarget(fun) {
+				return true
+			}
+
+			used := refs[alias.Ident.Name]
+			if alias.Local != nil {
+				used = references(fun.Body)[alias.Ident.Name]
+			}
+
+			if !used {
+				pass.Reportf(alias.Ident, "alias %s is unused", alias.Ident)
+			}
+			return true
+		})
+	}
+}
+
+func runUnusedParameter(pass *Pass) {
+	for _, fun := range funcDecls(pass.Root) {
+		if fun.Params == nil || fun.Body == nil {
+			continue
+		}
+
+		refs := references(fun.Body)
+		for _, param := range fun.Params.List {
+			if !refs[param.Name.Name] {
+				pass.Reportf(param, "parameter %s of %s is unused", param.Name, fun.Name)
+			}
+		}
+	}
+}
+
+// inspectCalls calls f for every call statement of a builtin or option.
+func inspectCalls(root ast.Node, name string, f func(call *ast.CallStmt)) {
+	ast.Inspect(root, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallStmt)
+		if ok && call.Func != nil && call.Func.Name == name {
+			f(call)
+		}
+		return true
+	})
+}
+
+// optionCalls returns the calls of an inline option block.
+func optionCalls(call *ast.CallStmt) []*ast.CallStmt {
+	if call.WithOpt == nil || call.WithOpt.BlockLit == nil || call.WithOpt.BlockLit.Body == nil {
+		return nil
+	}
+
+	var calls []*ast.CallStmt
+	for _, stmt := range call.WithOpt.BlockLit.Body.List {
+		if stmt.Call != nil {
+			calls = append(calls, stmt.Call)
+		}
+	}
+	return calls
+}
+
+func hasCall(calls []*ast.CallStmt, name string) bool {
+	for _, call := range calls {
+		if call.Func.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func stringArg(call *ast.CallStmt, i int) (string, bool) {
+	if len(call.Args) <= i {
+		return "", false
+	}
+
+	lit := call.Args[i].BasicLit
+	if lit == nil || lit.Str == nil {
+		return "", false
+	}
+	return *lit.Str, true
+}
+
+func funcDecls(root *ast.AST) []*ast.FuncDecl {
+	var funs []*ast.FuncDecl
+	for _, file := range root.Files {
+		for _, decl := range file.Decls {
+			if decl.Func != nil {
+				funs = append(funs, decl.Func)
+			}
+		}
+	}
+	return funs
+}
+
+// isTarget returns whether a function can be compiled as a target, in which
+// case it is used even if it is never called.
+func isTarget(fun *ast.FuncDecl) bool {
+	return fun.Type.Type() == ast.Filesystem && fun.Params.NumFields() == 0
+}
+
+// references returns the names of the identifiers that are used, rather than
+// declared, in a node.
+func references(root ast.Node) map[string]bool {
+	refs := make(map[string]bool)
+	ast.Inspect(root, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.CallStmt:
+			if n.Func != nil {
+				refs[n.Func.Name] = true
+			}
+		case *ast.Expr:
+			if n.Ident != nil {
+				refs[n.Ident.Name] = true
+			}
+		case *ast.WithOpt:
+			if n.Ident != nil {
+				refs[n.Ident.Name] = true
+			}
+		}
+		return true
+	})
+	return refs
+}
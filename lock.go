@@ -0,0 +1,129 @@
+package hlb
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/report"
+)
+
+const (
+	// LockFile is the default name of the lock of a program.
+	LockFile = "hlb.lock"
+)
+
+var commitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// LoadLock reads a lock written by SaveLock.
+func LoadLock(filename string) (*codegen.Lock, error) {
+	dt, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := codegen.NewLock()
+	err = json.Unmarshal(dt, lock)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return lock, nil
+}
+
+// SaveLock writes a lock as indented JSON, which sorts its sources so that
+// relocking the same sources doesn't change the file.
+func SaveLock(filename string, lock *codegen.Lock) error {
+	dt, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(dt, '\n'), HLBFileMode)
+}
+
+// ResolveSources locks sources to the current digest of their images, commit
+// of their git refs and checksum of their HTTP artifacts.
+func ResolveSources(ctx context.Context, sources []codegen.Source) (*codegen.Lock, error) {
+	lock := codegen.NewLock()
+	for _, source := range sources {
+		if _, ok := lock.Get(source.Kind, source.Key); ok {
+			continue
+		}
+
+		var (
+			v   string
+			err error
+		)
+		switch source.Kind {
+		case codegen.SourceImage:
+			v, err = ResolveImage(ctx, source.Key)
+		case codegen.SourceGit:
+			v, err = resolveGit(ctx, source.Key)
+		case codegen.SourceHTTP:
+			v, err = resolveHTTP(ctx, source.Key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to lock %s %q: %s", report.FormatPos(source.Call.Position()), source.Kind, source.Key, err)
+		}
+
+		lock.Set(source.Kind, source.Key, v)
+	}
+	return lock, nil
+}
+
+// resolveGit returns the commit that a git ref currently points to.
+func resolveGit(ctx context.Context, key string) (string, error) {
+	i := strings.LastIndex(key, "#")
+	remote, ref := key[:i], key[i+1:]
+	if commitRegexp.MatchString(ref) {
+		return ref, nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", remote, ref)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git ls-remote: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 || !commitRegexp.MatchString(fields[0]) {
+		return "", fmt.Errorf("ref not found")
+	}
+	return fields[0], nil
+}
+
+// resolveHTTP returns the checksum of the artifact currently served at a URL.
+func resolveHTTP(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(h, resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
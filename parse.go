@@ -43,6 +43,28 @@ func ParseMultiple(rs []io.Reader, opts ...ParseOption) ([]*ast.File, map[string
 	return files, ibs, nil
 }
 
+// Check semantically checks parsed files. Errors are annotated with excerpts
+// of the sources in ibs, as returned by ParseMultiple.
+func Check(files []*ast.File, ibs map[string]*report.IndexedBuffer, opts ...ParseOption) (*ast.AST, error) {
+	info := ParseInfo{
+		Color: aurora.NewAurora(false),
+	}
+
+	for _, opt := range opts {
+		err := opt(&info)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := report.SemanticCheck(files...)
+	if err != nil {
+		return root, report.NewSemanticError(info.Color, ibs, err)
+	}
+
+	return root, nil
+}
+
 func Parse(r io.Reader, opts ...ParseOption) (*ast.File, *report.IndexedBuffer, error) {
 	info := ParseInfo{
 		Stdout: os.Stdout,
@@ -82,9 +104,37 @@ func Parse(r io.Reader, opts ...ParseOption) (*ast.File, *report.IndexedBuffer,
 		return file, ib, nerr
 	}
 
-	err = ast.Parser.ParseFromLexer(peeker, file)
+	// Keep the tokens in case parsing fails and has to be recovered.
+	var tokens []lexer.Token
+	for i := 0; ; i++ {
+		token, err := peeker.Peek(i)
+		if err != nil {
+			return file, ib, err
+		}
+		if token.EOF() {
+			break
+		}
+		tokens = append(tokens, token)
+	}
+
+	whole := peeker.Clone()
+	err = ast.Parser.ParseFromLexer(whole, file)
 	if err != nil {
-		nerr, err := report.NewSyntaxError(info.Color, ib, peeker, err)
+		perr := err
+
+		eof, err := peeker.Peek(len(tokens))
+		if err != nil {
+			return file, ib, err
+		}
+
+		recovered, err := parseRecover(info, ib, tokens, eof)
+		if err != nil {
+			return recovered, ib, err
+		}
+
+		// Recovery should find at least the same error, but report it from the
+		// whole file otherwise.
+		nerr, err := report.NewSyntaxError(info.Color, ib, whole, perr)
 		if err != nil {
 			return file, ib, err
 		}
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/openllb/hlb/report"
 	"github.com/stretchr/testify/require"
 )
 
@@ -94,3 +95,46 @@ func TestParse(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, file)
 }
+
+func TestParseRecover(t *testing.T) {
+	t.Parallel()
+	file, _, err := Parse(strings.NewReader(`
+fs foo() {
+	scratch
+	mkdir "a" 0o755 )
+	run "echo"
+}
+
+fs bar( {
+	scratch
+}
+
+fs baz() {
+	scratch
+	image "alpine" with
+	mkdir "a" 0o755
+}
+`))
+	require.Error(t, err)
+
+	rerr, ok := err.(report.Error)
+	require.True(t, ok)
+	require.Len(t, rerr.Groups, 3)
+
+	// Each broken declaration reports its own error.
+	for i, lines := range [][2]int{{2, 6}, {8, 10}, {12, 16}} {
+		line := rerr.Groups[i].Pos.Line
+		require.True(t, line >= lines[0] && line <= lines[1], "error %d on line %d", i, line)
+	}
+
+	// Declarations with broken signatures are dropped, but the rest of the
+	// statements of broken bodies are kept.
+	var names []string
+	for _, decl := range file.Decls {
+		if decl.Func != nil {
+			names = append(names, decl.Func.Name.Name)
+			require.Equal(t, 2, decl.Func.Body.NumStmts())
+		}
+	}
+	require.Equal(t, []string{"foo", "baz"}, names)
+}
@@ -0,0 +1,207 @@
+package hlb
+
+import (
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+)
+
+var symbols = ast.Lexer.Symbols()
+
+// parseRecover parses a file that has syntax errors by resynchronizing at
+// top-level declarations and at statement ends, so that every syntax error is
+// reported instead of just the first. Declarations are parsed separately, and
+// statements that fail to parse are dropped from their declaration until the
+// rest of it parses. Declarations whose signature fails to parse are dropped.
+//
+// The returned file only has the declarations and statements that parsed.
+func parseRecover(info ParseInfo, ib *report.IndexedBuffer, tokens []lexer.Token, eof lexer.Token) (*ast.File, error) {
+	file := &ast.File{}
+	if len(tokens) > 0 {
+		file.Pos = tokens[0].Pos
+	}
+
+	var (
+		groups []report.AnnotationGroup
+		seen   = make(map[int]struct{})
+	)
+
+	chunks := splitDecls(tokens)
+	for i, chunk := range chunks {
+		chunkEOF := eof
+		if i+1 < len(chunks) {
+			chunkEOF = lexer.EOFToken(chunks[i+1][0].Pos)
+		}
+
+		for len(chunk) > 0 {
+			peeker, err := lexer.Upgrade(&tokenLexer{tokens: chunk, eof: chunkEOF})
+			if err != nil {
+				return file, err
+			}
+
+			decls := &ast.File{}
+			err = ast.Parser.ParseFromLexer(peeker, decls)
+			if err == nil {
+				file.Decls = append(file.Decls, decls.Decls...)
+				break
+			}
+
+			perr, ok := err.(participle.Error)
+			if !ok {
+				return file, err
+			}
+
+			// Dropping a statement may only move an error, so each position is
+			// reported once.
+			offset := perr.Token().Pos.Offset
+			if _, ok := seen[offset]; !ok {
+				seen[offset] = struct{}{}
+
+				nerr, err := report.NewSyntaxError(info.Color, ib, peeker, err)
+				if err != nil {
+					return file, err
+				}
+
+				if rerr, ok := nerr.(report.Error); ok {
+					groups = append(groups, rerr.Groups...)
+				}
+			}
+
+			chunk = dropStmt(chunk, offset)
+		}
+	}
+
+	if len(groups) == 0 {
+		return file, nil
+	}
+	return file, report.Error{Groups: groups}
+}
+
+// splitDecls splits tokens before each top-level declaration. A declaration
+// starts with a type at the start of a line, either outside of any block or
+// in the first column in case a previous block was never closed.
+func splitDecls(tokens []lexer.Token) [][]lexer.Token {
+	var (
+		chunks [][]lexer.Token
+		start  int
+		depth  int
+	)
+
+	for i, token := range tokens {
+		lineStart := i == 0 || isSymbol(tokens[i-1], "Newline") || isSymbol(tokens[i-1], "Comment")
+		if lineStart && isSymbol(token, "Type") && (depth <= 0 || token.Pos.Column == 1) {
+			if i > start {
+				chunks = append(chunks, tokens[start:i])
+			}
+			start = i
+			depth = 0
+		}
+
+		switch token.Value {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+
+	if start < len(tokens) {
+		chunks = append(chunks, tokens[start:])
+	}
+	return chunks
+}
+
+// dropStmt returns the tokens of a declaration without the statement that
+// contains the token at offset, or nil if the offset is not inside of a
+// block.
+func dropStmt(tokens []lexer.Token, offset int) []lexer.Token {
+	k := len(tokens)
+	for i, token := range tokens {
+		if token.Pos.Offset >= offset {
+			k = i
+			break
+		}
+	}
+
+	depth := 0
+	for _, token := range tokens[:k] {
+		switch token.Value {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+	if depth <= 0 {
+		return nil
+	}
+
+	// The statement starts after the previous statement end or block start.
+	start := k
+	for start > 0 {
+		prev := tokens[start-1]
+		if isStmtEnd(prev) || prev.Value == "{" {
+			break
+		}
+		start--
+	}
+
+	// The statement ends at the next statement end, including any nested
+	// blocks, but never closes the blocks it is in.
+	end := k
+	nested := 0
+loop:
+	for end < len(tokens) {
+		token := tokens[end]
+		if token.Value == "}" && nested == 0 {
+			break
+		}
+
+		end++
+		switch {
+		case token.Value == "{":
+			nested++
+		case token.Value == "}":
+			nested--
+		case nested == 0 && isStmtEnd(token):
+			break loop
+		}
+	}
+
+	// Always drop at least one token so that parsing makes progress.
+	if end == start {
+		if k == len(tokens) {
+			return nil
+		}
+		end = k + 1
+	}
+
+	dropped := make([]lexer.Token, 0, len(tokens)-(end-start))
+	dropped = append(dropped, tokens[:start]...)
+	return append(dropped, tokens[end:]...)
+}
+
+func isStmtEnd(token lexer.Token) bool {
+	return token.Value == ";" || isSymbol(token, "Newline") || isSymbol(token, "Comment")
+}
+
+func isSymbol(token lexer.Token, name string) bool {
+	return token.Type == symbols[name]
+}
+
+// tokenLexer is a lexer over tokens that were already lexed.
+type tokenLexer struct {
+	tokens []lexer.Token
+	eof    lexer.Token
+}
+
+func (l *tokenLexer) Next() (lexer.Token, error) {
+	if len(l.tokens) == 0 {
+		return l.eof, nil
+	}
+
+	token := l.tokens[0]
+	l.tokens = l.tokens[1:]
+	return token, nil
+}
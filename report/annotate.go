@@ -0,0 +1,182 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/logrusorgru/aurora"
+	"github.com/openllb/hlb/ast"
+)
+
+// NewSemanticError renders the errors of a semantic check as annotated source
+// excerpts like syntax errors, with suggestions for misspelled names. The
+// error is returned as is if any of its errors cannot be annotated, such as
+// when its source is not in ibs.
+func NewSemanticError(color aurora.Aurora, ibs map[string]*IndexedBuffer, err error) error {
+	serr, ok := err.(ErrSemantic)
+	if !ok {
+		serr = ErrSemantic{Errs: []error{err}}
+	}
+
+	var groups []AnnotationGroup
+	for _, e := range serr.Errs {
+		group, ok := annotateSemantic(color, ibs, e)
+		if !ok {
+			return err
+		}
+
+		group.Color = color
+		group.Kind = "semantic error"
+		group.Code = ErrorCode(e)
+		groups = append(groups, group)
+	}
+
+	return Error{Groups: groups}
+}
+
+func annotateSemantic(color aurora.Aurora, ibs map[string]*IndexedBuffer, err error) (group AnnotationGroup, ok bool) {
+	var (
+		pos        lexer.Position
+		message    string
+		candidates []string
+		name       string
+		help       string
+	)
+
+	switch e := err.(type) {
+	case ErrDuplicateDecls:
+		group.Pos = e.Idents[0].Pos
+		for i, ident := range e.Idents {
+			msg := color.Red("first declared here").String()
+			if i > 0 {
+				msg = color.Sprintf(color.Red("duplicate declaration of %s"), ident)
+			}
+
+			an, ok := annotate(ibs, ident.Pos, msg)
+			if !ok {
+				return group, false
+			}
+			group.Annotations = append(group.Annotations, an)
+		}
+		return group, true
+	case ErrDuplicateFields:
+		group.Pos = e.Fields[0].Pos
+		for i, field := range e.Fields {
+			msg := color.Red("first declared here").String()
+			if i > 0 {
+				msg = color.Sprintf(color.Red("duplicate field %s"), field.Name)
+			}
+
+			an, ok := annotate(ibs, field.Name.Pos, msg)
+			if !ok {
+				return group, false
+			}
+			group.Annotations = append(group.Annotations, an)
+		}
+		return group, true
+	case ErrNoSource:
+		pos, message = e.BlockStmt.Pos, "fs block statement must be non-empty"
+	case ErrFirstSource:
+		pos = e.CallStmt.Pos
+		message = fmt.Sprintf("first statement must be a source, found %s", e.CallStmt.Func)
+		help = helpValidKeywords(color, Sources, "fs source")
+	case ErrOnlyFirstSource:
+		pos = e.CallStmt.Pos
+		message = fmt.Sprintf("only first statement must be source, found %s", e.CallStmt.Func)
+	case ErrInvalidFunc:
+		pos = e.CallStmt.Pos
+		message = fmt.Sprintf("invalid func %s", e.CallStmt.Func)
+		name, candidates = e.CallStmt.Func.Name, e.Candidates
+	case ErrFuncSource:
+		pos = e.CallStmt.Pos
+		message = fmt.Sprintf("func %s must be used as a fs source", e.CallStmt.Func)
+	case ErrNumArgs:
+		pos = e.CallStmt.Pos
+		message = fmt.Sprintf("expected %d args, found %d", e.Expected, len(e.CallStmt.Args))
+	case ErrIdentNotDefined:
+		pos = e.Ident.Pos
+		message = fmt.Sprintf("ident %s not defined", e.Ident)
+		name, candidates = e.Ident.Name, e.Candidates
+	case ErrFuncArg:
+		pos = e.Ident.Pos
+		message = fmt.Sprintf("func %s must be used in a block literal", e.Ident)
+	case ErrWrongArgType:
+		pos = e.Pos
+		message = fmt.Sprintf("expected arg to be type %s, found %s", e.Expected, e.Found)
+	case ErrWrongOptionType:
+		pos = e.CallStmt.Pos
+		message = fmt.Sprintf("expected option %s to be type %s, found %s", e.CallStmt.Func, e.Expected, e.Found)
+	case ErrInvalidTarget:
+		pos = e.Ident.Position()
+		message = fmt.Sprintf("invalid compile target %s", e.Ident)
+	default:
+		return group, false
+	}
+
+	msg := color.Red(message).String()
+	if len(candidates) > 0 {
+		suggestion, exact := getSuggestion(color, candidates, name)
+		if !exact {
+			msg = fmt.Sprintf("%s%s", msg, suggestion)
+		}
+	}
+
+	an, ok := annotate(ibs, pos, msg)
+	if !ok {
+		return group, false
+	}
+
+	group.Pos = pos
+	group.Annotations = []Annotation{an}
+	group.Help = help
+	return group, true
+}
+
+// annotate returns an annotation underlining the token at a position.
+func annotate(ibs map[string]*IndexedBuffer, pos lexer.Position, message string) (Annotation, bool) {
+	ib, ok := ibs[pos.Filename]
+	if !ok {
+		return Annotation{}, false
+	}
+
+	segment, err := ib.Segment(pos.Offset)
+	if err != nil {
+		return Annotation{}, false
+	}
+
+	return Annotation{
+		Pos:     pos,
+		Token:   tokenAt(segment, pos),
+		Segment: segment,
+		Message: message,
+	}, true
+}
+
+// tokenAt lexes the token at a position of its line, so that nodes are
+// underlined like the tokens of syntax errors.
+func tokenAt(segment []byte, pos lexer.Position) lexer.Token {
+	token := lexer.Token{
+		Value: " ",
+		Pos:   pos,
+	}
+
+	column := pos.Column - 1
+	if column < 0 || column >= len(segment) {
+		return token
+	}
+
+	lex, err := ast.Parser.Lexer().Lex(bytes.NewReader(segment[column:]))
+	if err != nil {
+		return token
+	}
+
+	t, err := lex.Next()
+	if err != nil || t.EOF() {
+		return token
+	}
+
+	token.Type = t.Type
+	token.Value = t.Value
+	return token
+}
@@ -0,0 +1,223 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+const (
+	// SeverityError is the severity of errors that fail a command.
+	SeverityError = "error"
+)
+
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Diagnostic is a structured record of an error for tools, such as code
+// scanning and review bots, that annotate sources with errors.
+type Diagnostic struct {
+	Pos      lexer.Position
+	End      lexer.Position
+	Severity string
+	Code     string
+	Message  string
+}
+
+// Diagnostics returns the diagnostics of an error returned by parsing,
+// checking or generating code. Errors without a source position result in a
+// diagnostic without a filename.
+func Diagnostics(err error) []*Diagnostic {
+	if err == nil {
+		return nil
+	}
+
+	var ds []*Diagnostic
+	switch e := err.(type) {
+	case Error:
+		for _, group := range e.Groups {
+			ds = append(ds, groupDiagnostic(group))
+		}
+	case ErrSemantic:
+		for _, err := range e.Errs {
+			ds = append(ds, Diagnostics(err)...)
+		}
+	default:
+		d := &Diagnostic{
+			Severity: SeverityError,
+			Code:     ErrorCode(err),
+			Message:  stripANSI(err.Error()),
+		}
+
+		if perr, ok := err.(interface{ Position() lexer.Position }); ok {
+			d.Pos = perr.Position()
+			d.End = d.Pos
+			d.Message = strings.TrimPrefix(d.Message, FormatPos(d.Pos)+" ")
+		}
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+// ErrorCode returns a stable identifier for the kind of an error. Errors of
+// other packages may define their own with a Code method.
+func ErrorCode(err error) string {
+	switch err.(type) {
+	case ErrDuplicateDecls:
+		return "duplicate-decls"
+	case ErrDuplicateFields:
+		return "duplicate-fields"
+	case ErrNoSource:
+		return "no-source"
+	case ErrFirstSource:
+		return "first-source"
+	case ErrOnlyFirstSource:
+		return "only-first-source"
+	case ErrInvalidFunc:
+		return "invalid-func"
+	case ErrFuncSource:
+		return "func-source"
+	case ErrNumArgs:
+		return "num-args"
+	case ErrIdentNotDefined:
+		return "ident-not-defined"
+	case ErrFuncArg:
+		return "func-arg"
+	case ErrWrongArgType:
+		return "wrong-arg-type"
+	case ErrWrongOptionType:
+		return "wrong-option-type"
+	case ErrInvalidTarget:
+		return "invalid-target"
+	default:
+		if c, ok := err.(interface{ Code() string }); ok {
+			return c.Code()
+		}
+		return "error"
+	}
+}
+
+// groupDiagnostic returns the diagnostic of an annotation group, which spans
+// the token of its primary annotation.
+func groupDiagnostic(group AnnotationGroup) *Diagnostic {
+	code := group.Code
+	if code == "" {
+		code = "syntax"
+	}
+
+	d := &Diagnostic{
+		Pos:      group.Pos,
+		End:      group.Pos,
+		Severity: SeverityError,
+		Code:     code,
+	}
+
+	if len(group.Annotations) == 0 {
+		d.Message = strings.TrimSpace(stripANSI(group.String()))
+		return d
+	}
+
+	// Semantic groups end with the annotation of the error itself, whereas
+	// syntax groups annotate the unexpected token at the group position.
+	an := group.Annotations[len(group.Annotations)-1]
+	if group.Code == "" {
+		for _, a := range group.Annotations {
+			if a.Pos == group.Pos {
+				an = a
+				break
+			}
+		}
+	}
+
+	d.Message = stripANSI(an.Message)
+	if !an.Token.EOF() {
+		d.Pos = an.Pos
+		d.End = an.Pos
+		d.End.Column += utf8.RuneCountInString(an.Token.Value)
+		d.End.Offset += len(an.Token.Value)
+	}
+	return d
+}
+
+func stripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+type jsonDiagnostic struct {
+	Filename  string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Severity  string `json:"severity"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+// WriteDiagnosticsJSON writes diagnostics as a JSON array.
+func WriteDiagnosticsJSON(w io.Writer, ds []*Diagnostic) error {
+	jds := []*jsonDiagnostic{}
+	for _, d := range ds {
+		jds = append(jds, &jsonDiagnostic{
+			Filename:  d.Pos.Filename,
+			Line:      d.Pos.Line,
+			Column:    d.Pos.Column,
+			EndLine:   d.End.Line,
+			EndColumn: d.End.Column,
+			Severity:  d.Severity,
+			Code:      d.Code,
+			Message:   d.Message,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jds)
+}
+
+// WriteDiagnosticsSARIF writes diagnostics as a SARIF log.
+func WriteDiagnosticsSARIF(w io.Writer, ds []*Diagnostic) error {
+	log := NewSARIFLog("hlb")
+	run := log.Runs[0]
+
+	codes := make(map[string]struct{})
+	for _, d := range ds {
+		result := &SARIFResult{
+			RuleID:  d.Code,
+			Level:   d.Severity,
+			Message: SARIFMessage{Text: d.Message},
+		}
+
+		if d.Pos.Filename != "" {
+			loc := NewSARIFLocation(d.Pos)
+			if d.End.Line > 0 {
+				loc.PhysicalLocation.Region.EndLine = d.End.Line
+				loc.PhysicalLocation.Region.EndColumn = d.End.Column
+			}
+			result.Locations = append(result.Locations, loc)
+		}
+
+		run.Results = append(run.Results, result)
+		codes[d.Code] = struct{}{}
+	}
+
+	var sorted []string
+	for code := range codes {
+		sorted = append(sorted, code)
+	}
+	sort.Strings(sorted)
+
+	for _, code := range sorted {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, &SARIFRule{
+			ID:               code,
+			ShortDescription: SARIFMessage{Text: fmt.Sprintf("hlb %s error", code)},
+		})
+	}
+
+	return log.Encode(w)
+}
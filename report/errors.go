@@ -2,6 +2,7 @@ package report
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/alecthomas/participle/lexer"
@@ -25,6 +26,27 @@ func (e ErrSemantic) Error() string {
 	return strings.Join(errs, "\n")
 }
 
+// SortErrors sorts errors by the position of the source they point at. Errors
+// without a position are sorted last.
+func SortErrors(errs []error) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		pi, iok := errs[i].(interface{ Position() lexer.Position })
+		pj, jok := errs[j].(interface{ Position() lexer.Position })
+		if !iok || !jok {
+			return iok && !jok
+		}
+
+		a, b := pi.Position(), pj.Position()
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
 type ErrDuplicateDecls struct {
 	Idents []*ast.Ident
 }
@@ -33,6 +55,8 @@ func (e ErrDuplicateDecls) Error() string {
 	return fmt.Sprintf("%s duplicate decls named %s", FormatPos(e.Idents[0].Pos), e.Idents[0].String())
 }
 
+func (e ErrDuplicateDecls) Position() lexer.Position { return e.Idents[0].Pos }
+
 type ErrDuplicateFields struct {
 	Fields []*ast.Field
 }
@@ -41,6 +65,8 @@ func (e ErrDuplicateFields) Error() string {
 	return fmt.Sprintf("%s duplicate fields named %s", FormatPos(e.Fields[0].Pos), e.Fields[0].Name)
 }
 
+func (e ErrDuplicateFields) Position() lexer.Position { return e.Fields[0].Pos }
+
 type ErrNoSource struct {
 	BlockStmt *ast.BlockStmt
 }
@@ -49,6 +75,8 @@ func (e ErrNoSource) Error() string {
 	return fmt.Sprintf("%s fs block statement must be non-empty", FormatPos(e.BlockStmt.Pos))
 }
 
+func (e ErrNoSource) Position() lexer.Position { return e.BlockStmt.Pos }
+
 type ErrFirstSource struct {
 	CallStmt *ast.CallStmt
 }
@@ -57,6 +85,8 @@ func (e ErrFirstSource) Error() string {
 	return fmt.Sprintf("%s first statement must be source", FormatPos(e.CallStmt.Pos))
 }
 
+func (e ErrFirstSource) Position() lexer.Position { return e.CallStmt.Pos }
+
 type ErrOnlyFirstSource struct {
 	CallStmt *ast.CallStmt
 }
@@ -65,14 +95,21 @@ func (e ErrOnlyFirstSource) Error() string {
 	return fmt.Sprintf("%s only first statement must be source", FormatPos(e.CallStmt.Pos))
 }
 
+func (e ErrOnlyFirstSource) Position() lexer.Position { return e.CallStmt.Pos }
+
 type ErrInvalidFunc struct {
 	CallStmt *ast.CallStmt
+
+	// Candidates are the names of the funcs that are valid for the call.
+	Candidates []string
 }
 
 func (e ErrInvalidFunc) Error() string {
 	return fmt.Sprintf("%s invalid func %s", FormatPos(e.CallStmt.Pos), e.CallStmt.Func)
 }
 
+func (e ErrInvalidFunc) Position() lexer.Position { return e.CallStmt.Pos }
+
 type ErrFuncSource struct {
 	CallStmt *ast.CallStmt
 }
@@ -81,6 +118,8 @@ func (e ErrFuncSource) Error() string {
 	return fmt.Sprintf("%s func %s must be used as a fs source", FormatPos(e.CallStmt.Pos), e.CallStmt.Func)
 }
 
+func (e ErrFuncSource) Position() lexer.Position { return e.CallStmt.Pos }
+
 type ErrNumArgs struct {
 	Expected int
 	CallStmt *ast.CallStmt
@@ -90,14 +129,21 @@ func (e ErrNumArgs) Error() string {
 	return fmt.Sprintf("%s expected %d args, found %d", FormatPos(e.CallStmt.Pos), e.Expected, len(e.CallStmt.Args))
 }
 
+func (e ErrNumArgs) Position() lexer.Position { return e.CallStmt.Pos }
+
 type ErrIdentNotDefined struct {
 	Ident *ast.Ident
+
+	// Candidates are the names of the identifiers in scope.
+	Candidates []string
 }
 
 func (e ErrIdentNotDefined) Error() string {
 	return fmt.Sprintf("%s ident %s not defined", FormatPos(e.Ident.Pos), e.Ident)
 }
 
+func (e ErrIdentNotDefined) Position() lexer.Position { return e.Ident.Pos }
+
 type ErrFuncArg struct {
 	Ident *ast.Ident
 }
@@ -106,6 +152,8 @@ func (e ErrFuncArg) Error() string {
 	return fmt.Sprintf("%s func %s must be used in a block literal", FormatPos(e.Ident.Pos), e.Ident)
 }
 
+func (e ErrFuncArg) Position() lexer.Position { return e.Ident.Pos }
+
 type ErrWrongArgType struct {
 	Pos      lexer.Position
 	Expected ast.ObjType
@@ -116,6 +164,20 @@ func (e ErrWrongArgType) Error() string {
 	return fmt.Sprintf("%s expected arg to be type %s, found %s", FormatPos(e.Pos), e.Expected, e.Found)
 }
 
+func (e ErrWrongArgType) Position() lexer.Position { return e.Pos }
+
+type ErrWrongOptionType struct {
+	CallStmt *ast.CallStmt
+	Expected ast.ObjType
+	Found    ast.ObjType
+}
+
+func (e ErrWrongOptionType) Error() string {
+	return fmt.Sprintf("%s expected option %s to be type %s, found %s", FormatPos(e.CallStmt.Pos), e.CallStmt.Func, e.Expected, e.Found)
+}
+
+func (e ErrWrongOptionType) Position() lexer.Position { return e.CallStmt.Pos }
+
 type ErrInvalidTarget struct {
 	Ident *ast.Ident
 }
@@ -123,3 +185,5 @@ type ErrInvalidTarget struct {
 func (e ErrInvalidTarget) Error() string {
 	return fmt.Sprintf("%s invalid compile target %s", FormatPos(e.Ident.Position()), e.Ident)
 }
+
+func (e ErrInvalidTarget) Position() lexer.Position { return e.Ident.Position() }
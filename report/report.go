@@ -17,6 +17,7 @@ var (
 	Sources = []string{"scratch", "image", "http", "git", "local", "generate"}
 	Ops     = []string{"shell", "run", "env", "dir", "user", "entrypoint", "mkdir", "mkfile", "rm", "copy"}
 	Debugs  = []string{"breakpoint"}
+	Asserts = []string{"assertExists", "assertContent", "assertRun"}
 
 	CommonOptions   = []string{"no-cache"}
 	ImageOptions    = []string{"resolve"}
@@ -75,6 +76,17 @@ var (
 		ast.Filesystem: map[string][]*ast.Field{
 			// Debug ops
 			"breakpoint": nil,
+			// Assert ops
+			"assertExists": []*ast.Field{
+				ast.NewField(ast.Str, "path", false),
+			},
+			"assertContent": []*ast.Field{
+				ast.NewField(ast.Str, "path", false),
+				ast.NewField(ast.Str, "content", false),
+			},
+			"assertRun": []*ast.Field{
+				ast.NewField(ast.Str, "arg", true),
+			},
 			// Source ops
 			"scratch": nil,
 			"image": []*ast.Field{
@@ -283,6 +295,12 @@ var (
 			"contentsOnly":   nil,
 			"unpack":         nil,
 			"createDestPath": nil,
+			"chown": []*ast.Field{
+				ast.NewField(ast.Str, "owner", false),
+			},
+			"createdTime": []*ast.Field{
+				ast.NewField(ast.Str, "created", false),
+			},
 		},
 	}
 )
@@ -328,6 +346,14 @@ type AnnotationGroup struct {
 	Pos         lexer.Position
 	Annotations []Annotation
 	Help        string
+
+	// Kind is the kind of error in the header, which defaults to a syntax
+	// error.
+	Kind string
+
+	// Code identifies the kind of error in diagnostics, which defaults to
+	// syntax.
+	Code string
 }
 
 func (ag AnnotationGroup) String() string {
@@ -354,11 +380,16 @@ func (ag AnnotationGroup) String() string {
 		annotations = append(annotations, strings.Join(lines, "\n"))
 	}
 
+	kind := ag.Kind
+	if kind == "" {
+		kind = "syntax error"
+	}
+
 	gutter := strings.Repeat(" ", maxLn)
 	header := fmt.Sprintf(
 		"%s %s",
 		ag.Color.Sprintf(ag.Color.Blue("%s-->"), gutter),
-		ag.Color.Sprintf(ag.Color.Bold("%s:%d:%d: syntax error"), ag.Pos.Filename, ag.Pos.Line, ag.Pos.Column))
+		ag.Color.Sprintf(ag.Color.Bold("%s:%d:%d: %s"), ag.Pos.Filename, ag.Pos.Line, ag.Pos.Column, kind))
 	body := strings.Join(annotations, ag.Color.Sprintf(ag.Color.Blue("\n%s ⫶\n"), gutter))
 
 	var footer string
@@ -424,6 +455,11 @@ func NewIndexedBuffer() *IndexedBuffer {
 	}
 }
 
+// Bytes returns the contents of the buffer.
+func (ib *IndexedBuffer) Bytes() []byte {
+	return ib.buf.Bytes()
+}
+
 func (ib *IndexedBuffer) Len() int {
 	return len(ib.offsets)
 }
@@ -0,0 +1,116 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/alecthomas/participle/lexer"
+)
+
+const (
+	// SARIFVersion is the version of the Static Analysis Results Interchange
+	// Format written by NewSARIFLog.
+	SARIFVersion = "2.1.0"
+
+	// SARIFSchema is the JSON schema of SARIFVersion.
+	SARIFSchema = "https://schemastore.azurewebsites.net/schemas/json/sarif-2.1.0-rtm.4.json"
+)
+
+// SARIFLog is the root of a SARIF file, which code scanning tools use to
+// show diagnostics next to the source they point at.
+type SARIFLog struct {
+	Version string      `json:"version"`
+	Schema  string      `json:"$schema"`
+	Runs    []*SARIFRun `json:"runs"`
+}
+
+// SARIFRun is the results of a single tool.
+type SARIFRun struct {
+	Tool    SARIFTool      `json:"tool"`
+	Results []*SARIFResult `json:"results"`
+}
+
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+type SARIFDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri,omitempty"`
+	Rules          []*SARIFRule `json:"rules,omitempty"`
+}
+
+type SARIFRule struct {
+	ID               string       `json:"id"`
+	ShortDescription SARIFMessage `json:"shortDescription"`
+}
+
+type SARIFResult struct {
+	RuleID    string           `json:"ruleId,omitempty"`
+	Level     string           `json:"level"`
+	Message   SARIFMessage     `json:"message"`
+	Locations []*SARIFLocation `json:"locations,omitempty"`
+}
+
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+type SARIFLocation struct {
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+}
+
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+	Region           SARIFRegion           `json:"region"`
+}
+
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type SARIFRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// NewSARIFLog returns a log with a single run of the named tool.
+func NewSARIFLog(name string) *SARIFLog {
+	return &SARIFLog{
+		Version: SARIFVersion,
+		Schema:  SARIFSchema,
+		Runs: []*SARIFRun{{
+			Tool: SARIFTool{
+				Driver: SARIFDriver{
+					Name:           name,
+					InformationURI: "https://github.com/openllb/hlb",
+				},
+			},
+			Results: []*SARIFResult{},
+		}},
+	}
+}
+
+// NewSARIFLocation returns the location of a source position.
+func NewSARIFLocation(pos lexer.Position) *SARIFLocation {
+	return &SARIFLocation{
+		PhysicalLocation: SARIFPhysicalLocation{
+			ArtifactLocation: SARIFArtifactLocation{
+				URI: pos.Filename,
+			},
+			Region: SARIFRegion{
+				StartLine:   pos.Line,
+				StartColumn: pos.Column,
+			},
+		},
+	}
+}
+
+// Encode writes the log as indented JSON.
+func (l *SARIFLog) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
@@ -44,7 +44,9 @@ func SemanticCheck(files ...*ast.File) (*ast.AST, error) {
 	root := ast.NewAST(files...)
 
 	var (
-		dupDecls []*ast.Ident
+		errs     []error
+		dupNames []string
+		dupDecls = make(map[string][]*ast.Ident)
 	)
 
 	ast.Inspect(root, func(node ast.Node) bool {
@@ -55,18 +57,21 @@ func SemanticCheck(files ...*ast.File) (*ast.AST, error) {
 			if fun.Name != nil {
 				obj := root.Scope.Lookup(fun.Name.Name)
 				if obj != nil {
-					if len(dupDecls) == 0 {
-						dupDecls = append(dupDecls, obj.Ident)
+					// Duplicates are still checked, but only the first
+					// declaration is in scope.
+					name := fun.Name.Name
+					if _, ok := dupDecls[name]; !ok {
+						dupNames = append(dupNames, name)
+						dupDecls[name] = []*ast.Ident{obj.Ident}
 					}
-					dupDecls = append(dupDecls, fun.Name)
-					return false
+					dupDecls[name] = append(dupDecls[name], fun.Name)
+				} else {
+					root.Scope.Insert(&ast.Object{
+						Kind:  ast.DeclKind,
+						Ident: fun.Name,
+						Node:  fun,
+					})
 				}
-
-				root.Scope.Insert(&ast.Object{
-					Kind:  ast.DeclKind,
-					Ident: fun.Name,
-					Node:  fun,
-				})
 			}
 
 			fun.Scope = ast.NewScope(fun, root.Scope)
@@ -109,11 +114,10 @@ func SemanticCheck(files ...*ast.File) (*ast.AST, error) {
 		}
 		return true
 	})
-	if len(dupDecls) > 0 {
-		return root, ErrDuplicateDecls{dupDecls}
+	for _, name := range dupNames {
+		errs = append(errs, ErrDuplicateDecls{dupDecls[name]})
 	}
 
-	var errs []error
 	ast.Inspect(root, func(n ast.Node) bool {
 		fun, ok := n.(*ast.FuncDecl)
 		if !ok {
@@ -124,7 +128,6 @@ func SemanticCheck(files ...*ast.File) (*ast.AST, error) {
 			err := checkFieldList(fun.Params.List)
 			if err != nil {
 				errs = append(errs, err)
-				return false
 			}
 		}
 
@@ -134,16 +137,13 @@ func SemanticCheck(files ...*ast.File) (*ast.AST, error) {
 				op = string(fun.Type.SubType())
 			}
 
-			err := checkBlockStmt(fun.Scope, fun.Type, fun.Body, op)
-			if err != nil {
-				errs = append(errs, err)
-				return false
-			}
+			errs = append(errs, checkBlockStmt(fun.Scope, fun.Type, fun.Body, op)...)
 		}
 
 		return true
 	})
 	if len(errs) > 0 {
+		SortErrors(errs)
 		return root, ErrSemantic{errs}
 	}
 
@@ -178,15 +178,16 @@ func checkFieldList(fields []*ast.Field) error {
 	return nil
 }
 
-func checkBlockStmt(scope *ast.Scope, typ *ast.Type, block *ast.BlockStmt, op string) error {
+func checkBlockStmt(scope *ast.Scope, typ *ast.Type, block *ast.BlockStmt, op string) []error {
 	if typ.Equals(ast.Option) {
 		return checkOptionBlockStmt(scope, typ, block, op)
 	}
 
 	if block.NumStmts() == 0 {
-		return ErrNoSource{block}
+		return []error{ErrNoSource{block}}
 	}
 
+	var errs []error
 	foundSource := false
 
 	i := -1
@@ -199,10 +200,15 @@ func checkBlockStmt(scope *ast.Scope, typ *ast.Type, block *ast.BlockStmt, op st
 		i++
 
 		if !foundSource {
+			// Statements after an invalid source are still checked as if it
+			// was valid.
+			foundSource = true
+
 			if !Contains(BuiltinSources[typ.Type()], call.Func.Name) {
 				obj := scope.Lookup(call.Func.Name)
 				if obj == nil {
-					return ErrFirstSource{call}
+					errs = append(errs, ErrFirstSource{call})
+					continue
 				}
 
 				var callType *ast.Type
@@ -222,32 +228,27 @@ func checkBlockStmt(scope *ast.Scope, typ *ast.Type, block *ast.BlockStmt, op st
 				}
 
 				if !callType.Equals(typ.Type()) {
-					return ErrFirstSource{call}
+					errs = append(errs, ErrFirstSource{call})
+					continue
 				}
 			}
-			foundSource = true
 
-			err := checkCallStmt(scope, typ, i, call, op)
-			if err != nil {
-				return err
-			}
+			errs = append(errs, checkCallStmt(scope, typ, i, call, op)...)
 			continue
 		}
 
 		if Contains(BuiltinSources[typ.Type()], call.Func.Name) {
-			return ErrOnlyFirstSource{call}
+			errs = append(errs, ErrOnlyFirstSource{call})
+			continue
 		}
 
-		err := checkCallStmt(scope, typ, i, call, op)
-		if err != nil {
-			return err
-		}
+		errs = append(errs, checkCallStmt(scope, typ, i, call, op)...)
 	}
 
-	return nil
+	return errs
 }
 
-func checkCallStmt(scope *ast.Scope, typ *ast.Type, index int, call *ast.CallStmt, op string) error {
+func checkCallStmt(scope *ast.Scope, typ *ast.Type, index int, call *ast.CallStmt, op string) []error {
 	var (
 		funcs  []string
 		params []*ast.Field
@@ -259,6 +260,9 @@ func checkCallStmt(scope *ast.Scope, typ *ast.Type, index int, call *ast.CallStm
 			funcs = flatMap(BuiltinSources[typ.Type()], Debugs)
 		} else {
 			funcs = flatMap(Ops, Debugs)
+			if typ.Type() == ast.Filesystem {
+				funcs = flatMap(funcs, Asserts)
+			}
 		}
 		builtins := Builtins[typ.Type()][call.Func.Name]
 		params = handleVariadicParams(builtins, call.Args)
@@ -272,69 +276,86 @@ func checkCallStmt(scope *ast.Scope, typ *ast.Type, index int, call *ast.CallStm
 	if !Contains(funcs, call.Func.Name) {
 		obj := scope.Lookup(call.Func.Name)
 		if obj == nil {
-			return ErrInvalidFunc{call}
+			return []error{ErrInvalidFunc{
+				CallStmt:   call,
+				Candidates: flatMap(funcs, scopeNames(scope)),
+			}}
 		}
 
-		var fields []*ast.Field
+		var (
+			fields   []*ast.Field
+			callType *ast.Type
+		)
 		if obj.Kind == ast.DeclKind {
 			switch n := obj.Node.(type) {
 			case *ast.FuncDecl:
-				fields = n.Params.List
+				fields, callType = n.Params.List, n.Type
 			case *ast.AliasDecl:
-				fields = n.Func.Params.List
+				fields, callType = n.Func.Params.List, n.Func.Type
 			default:
 				panic("unknown decl object")
 			}
 		}
+
+		// Options of one call cannot be used in the option block of another,
+		// such as options of copy in an option block of run.
+		if typ.Type() == ast.Option && callType != nil && !typeMatches(typ.ObjType, callType.ObjType) {
+			return []error{ErrWrongOptionType{call, typ.ObjType, callType.ObjType}}
+		}
 		params = handleVariadicParams(fields, call.Args)
 	}
 
 	if len(params) != len(call.Args) {
-		return ErrNumArgs{len(params), call}
+		return []error{ErrNumArgs{len(params), call}}
 	}
 
+	var errs []error
 	for i, arg := range call.Args {
 		typ := params[i].Type
 
-		var err error
 		switch {
 		case arg.Ident != nil:
-			err = checkIdentArg(scope, typ.Type(), arg.Ident)
+			err := checkIdentArg(scope, typ.ObjType, arg.Ident)
+			if err != nil {
+				errs = append(errs, err)
+			}
 		case arg.BasicLit != nil:
-			err = checkBasicLitArg(typ.Type(), arg.BasicLit)
-
+			err := checkBasicLitArg(typ.Type(), arg.BasicLit)
+			if err != nil {
+				errs = append(errs, err)
+			}
 		case arg.BlockLit != nil:
-			err = checkBlockLitArg(scope, typ.Type(), arg.BlockLit, call.Func.Name)
+			errs = append(errs, checkBlockLitArg(scope, typ.ObjType, arg.BlockLit, call.Func.Name)...)
 		default:
 			panic("unknown field type")
 		}
-		if err != nil {
-			return err
-		}
 	}
 
 	if call.WithOpt != nil {
-		var err error
+		optionType := ast.ObjType(fmt.Sprintf("%s::%s", ast.Option, call.Func.Name))
 		switch {
 		case call.WithOpt.Ident != nil:
-			err = checkIdentArg(scope, ast.Option, call.WithOpt.Ident)
+			err := checkIdentArg(scope, optionType, call.WithOpt.Ident)
+			if err != nil {
+				errs = append(errs, err)
+			}
 		case call.WithOpt.BlockLit != nil:
-			err = checkBlockLitArg(scope, ast.Option, call.WithOpt.BlockLit, call.Func.Name)
+			errs = append(errs, checkBlockLitArg(scope, optionType, call.WithOpt.BlockLit, call.Func.Name)...)
 		default:
 			panic("unknown with opt type")
 		}
-		if err != nil {
-			return err
-		}
 	}
 
-	return nil
+	return errs
 }
 
 func checkIdentArg(scope *ast.Scope, typ ast.ObjType, ident *ast.Ident) error {
 	obj := scope.Lookup(ident.Name)
 	if obj == nil {
-		return ErrIdentNotDefined{ident}
+		return ErrIdentNotDefined{
+			Ident:      ident,
+			Candidates: scopeNames(scope),
+		}
 	}
 
 	switch obj.Kind {
@@ -344,6 +365,9 @@ func checkIdentArg(scope *ast.Scope, typ ast.ObjType, ident *ast.Ident) error {
 			if n.Params.NumFields() > 0 {
 				return ErrFuncArg{ident}
 			}
+			if n.Type.Equals(ast.Option) && !typeMatches(typ, n.Type.ObjType) {
+				return ErrWrongArgType{ident.Pos, typ, n.Type.ObjType}
+			}
 		case *ast.AliasDecl:
 			if n.Func.Params.NumFields() > 0 {
 				return ErrFuncArg{ident}
@@ -355,8 +379,8 @@ func checkIdentArg(scope *ast.Scope, typ ast.ObjType, ident *ast.Ident) error {
 		var err error
 		switch d := obj.Node.(type) {
 		case *ast.Field:
-			if !d.Type.Equals(typ) {
-				return ErrWrongArgType{ident.Pos, typ, d.Type.Type()}
+			if !typeMatches(typ, d.Type.ObjType) {
+				return ErrWrongArgType{ident.Pos, typ, d.Type.ObjType}
 			}
 		default:
 			panic("unknown arg type")
@@ -390,15 +414,40 @@ func checkBasicLitArg(typ ast.ObjType, lit *ast.BasicLit) error {
 	return nil
 }
 
-func checkBlockLitArg(scope *ast.Scope, typ ast.ObjType, lit *ast.BlockLit, op string) error {
-	if !lit.Type.Equals(typ) {
-		return ErrWrongArgType{lit.Pos, typ, lit.Type.ObjType}
+func checkBlockLitArg(scope *ast.Scope, typ ast.ObjType, lit *ast.BlockLit, op string) []error {
+	if !typeMatches(typ, lit.Type.ObjType) {
+		return []error{ErrWrongArgType{lit.Pos, typ, lit.Type.ObjType}}
+	}
+
+	// Option blocks are checked against the option type they are used as,
+	// which may be narrower than the call they are passed to.
+	for _, t := range []*ast.Type{lit.Type, ast.NewType(typ)} {
+		if sub := t.SubType(); t.Equals(ast.Option) && sub != ast.None {
+			op = string(sub)
+			break
+		}
 	}
 
 	return checkBlockStmt(scope, lit.Type, lit.Body, op)
 }
 
-func checkOptionBlockStmt(scope *ast.Scope, typ *ast.Type, block *ast.BlockStmt, op string) error {
+// typeMatches returns whether a value of type found can be used as type
+// expected. Options must also be of the same call when both types have a
+// subtype, like option::run, but an option without a subtype matches any.
+func typeMatches(expected, found ast.ObjType) bool {
+	e, f := ast.NewType(expected), ast.NewType(found)
+	if e.Type() != f.Type() {
+		return false
+	}
+	if e.SubType() == ast.None || f.SubType() == ast.None {
+		return true
+	}
+	return e.SubType() == f.SubType()
+}
+
+func checkOptionBlockStmt(scope *ast.Scope, typ *ast.Type, block *ast.BlockStmt, op string) []error {
+	var errs []error
+
 	i := -1
 	for _, stmt := range block.List {
 		call := stmt.Call
@@ -408,19 +457,27 @@ func checkOptionBlockStmt(scope *ast.Scope, typ *ast.Type, block *ast.BlockStmt,
 		i++
 
 		callType := ast.NewType(ast.ObjType(fmt.Sprintf("%s::%s", ast.Option, op)))
-		err := checkCallStmt(scope, callType, i, call, op)
-		if err != nil {
-			return err
+		errs = append(errs, checkCallStmt(scope, callType, i, call, op)...)
+	}
+	return errs
+}
+
+// scopeNames returns the names of the decls and fields in scope.
+func scopeNames(scope *ast.Scope) []string {
+	var names []string
+	for _, kind := range []ast.ObjKind{ast.DeclKind, ast.FieldKind} {
+		for _, obj := range scope.Defined(kind) {
+			names = append(names, obj.Ident.Name)
 		}
 	}
-	return nil
+	return names
 }
 
 func handleVariadicParams(fields []*ast.Field, args []*ast.Expr) []*ast.Field {
 	params := make([]*ast.Field, len(fields))
 	copy(params, fields)
 
-	if len(params) > 0 && params[len(params)-1].Variadic != nil {
+	if len(params) > 0 && params[len(params)-1].Variadic != nil && len(args) >= len(params)-1 {
 		variadicParam := params[len(params)-1]
 		params = params[:len(params)-1]
 		for i, _ := range args[len(params):] {
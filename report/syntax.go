@@ -51,7 +51,10 @@ func NewSyntaxError(color aurora.Aurora, ib *IndexedBuffer, lex *lexer.PeekingLe
 			return nil, err
 		}
 
-		groups = append(groups, group)
+		// Unexpected tokens without a specific error have the default error.
+		if len(group.Annotations) > 0 {
+			groups = append(groups, group)
+		}
 	}
 
 	if len(groups) == 0 {
@@ -0,0 +1,240 @@
+package hlb
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemanticCheckCollectsErrors(t *testing.T) {
+	t.Parallel()
+	rs := []io.Reader{
+		&namedReader{strings.NewReader(`
+fs baz() {
+	scratch
+	env "key"
+}
+`), "b.hlb"},
+		&namedReader{strings.NewReader(`
+fs foo() {
+	scratch
+	image "alpine"
+	mkdir "path" "filemode"
+}
+
+fs foo() {
+	bar
+	run 1
+}
+`), "a.hlb"},
+	}
+
+	files, _, err := ParseMultiple(rs)
+	require.NoError(t, err)
+
+	_, err = report.SemanticCheck(files...)
+	require.Error(t, err)
+
+	serr, ok := err.(report.ErrSemantic)
+	require.True(t, ok)
+
+	var actual []string
+	for _, err := range serr.Errs {
+		pos := err.(interface{ Position() lexer.Position }).Position()
+		actual = append(actual, fmt.Sprintf("%s:%d %T", pos.Filename, pos.Line, err))
+	}
+
+	require.Equal(t, []string{
+		"a.hlb:2 report.ErrDuplicateDecls",
+		"a.hlb:4 report.ErrOnlyFirstSource",
+		"a.hlb:5 report.ErrWrongArgType",
+		"a.hlb:9 report.ErrFirstSource",
+		"a.hlb:10 report.ErrWrongArgType",
+		"b.hlb:4 report.ErrNumArgs",
+	}, actual)
+}
+
+func TestCheckAnnotatesErrors(t *testing.T) {
+	t.Parallel()
+	files, ibs, err := ParseMultiple([]io.Reader{strings.NewReader(`
+fs foo(string path) {
+	scratch
+	mkdri paht 0o755
+}
+`)})
+	require.NoError(t, err)
+
+	_, err = Check(files, ibs)
+	require.Error(t, err)
+
+	_, ok := err.(report.Error)
+	require.True(t, ok)
+
+	for _, expected := range []string{
+		"<stdin>:4:2: semantic error",
+		"4 | \tmkdri paht 0o755",
+		"\t^^^^^",
+		"invalid func mkdri, did you mean mkdir?",
+	} {
+		require.Contains(t, err.Error(), expected)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	t.Parallel()
+	files, ibs, err := ParseMultiple([]io.Reader{strings.NewReader(`
+fs foo(string path) {
+	scratch
+	mkdri paht 0o755
+}
+`)}, WithColor(true))
+	require.NoError(t, err)
+
+	_, err = Check(files, ibs, WithColor(true))
+	require.Error(t, err)
+
+	ds := report.Diagnostics(err)
+	require.Len(t, ds, 1)
+	require.Equal(t, "<stdin>", ds[0].Pos.Filename)
+	require.Equal(t, 4, ds[0].Pos.Line)
+	require.Equal(t, 2, ds[0].Pos.Column)
+	require.Equal(t, 4, ds[0].End.Line)
+	require.Equal(t, 7, ds[0].End.Column)
+	require.Equal(t, report.SeverityError, ds[0].Severity)
+	require.Equal(t, "invalid-func", ds[0].Code)
+	require.Equal(t, "invalid func mkdri, did you mean mkdir?", ds[0].Message)
+
+	_, _, err = Parse(strings.NewReader(`
+fs foo() {
+	scratch
+	)
+}
+`))
+	require.Error(t, err)
+
+	ds = report.Diagnostics(err)
+	require.Len(t, ds, 1)
+	require.Equal(t, 4, ds[0].Pos.Line)
+	require.Equal(t, 2, ds[0].Pos.Column)
+	require.Equal(t, "syntax", ds[0].Code)
+
+	ds = report.Diagnostics(fmt.Errorf("no position"))
+	require.Len(t, ds, 1)
+	require.Equal(t, "", ds[0].Pos.Filename)
+	require.Equal(t, "error", ds[0].Code)
+	require.Equal(t, "no position", ds[0].Message)
+}
+
+func TestSemanticCheckOptionTypes(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		input    string
+		expected []string
+	}{{
+		"matching option func",
+		`
+fs default() {
+	image "alpine"
+	run "echo" with runOpts
+}
+
+option::run runOpts() {
+	dir "/"
+}
+`,
+		nil,
+	}, {
+		"copy owner and created time",
+		`
+fs default() {
+	image "alpine"
+	copy fs { scratch; } "/" "/" with option {
+		chown "1000:1000"
+		createdTime "1970-01-01T00:00:00Z"
+	}
+}
+`,
+		nil,
+	}, {
+		"option func of another call",
+		`
+fs default() {
+	image "alpine"
+	run "echo" with copyOpts
+}
+
+option::copy copyOpts() {
+	createDestPath
+}
+`,
+		[]string{"<stdin>:4:18: expected arg to be type option::run, found option::copy"},
+	}, {
+		"option param of another call",
+		`
+fs default() {
+	build option::copy {
+		createDestPath
+	}
+}
+
+fs build(option::copy opts) {
+	image "alpine"
+	run "echo" with opts
+}
+`,
+		[]string{"<stdin>:10:18: expected arg to be type option::run, found option::copy"},
+	}, {
+		"option block of another call",
+		`
+fs default() {
+	image "alpine"
+	run "echo" with option::copy {
+		createDestPath
+	}
+}
+`,
+		[]string{"<stdin>:4:18: expected arg to be type option::run, found option::copy"},
+	}, {
+		"option block calling options of another call",
+		`
+option::run runOpts() {
+	dir "/"
+	copyOpts
+}
+
+option::copy copyOpts() {
+	createDestPath
+}
+`,
+		[]string{"<stdin>:4:2: expected option copyOpts to be type option::run, found option::copy"},
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			file, _, err := Parse(strings.NewReader(tc.input))
+			require.NoError(t, err)
+
+			_, err = report.SemanticCheck(file)
+			if tc.expected == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+
+			serr, ok := err.(report.ErrSemantic)
+			require.True(t, ok)
+
+			var actual []string
+			for _, err := range serr.Errs {
+				actual = append(actual, err.Error())
+			}
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,443 @@
+package hlb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/client/llb"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/report"
+	"github.com/openllb/hlb/solver"
+)
+
+const (
+	// SignatureManifest lists the sha256 digest of every file published in a
+	// frontend, in the format of sha256sum.
+	SignatureManifest = "signature.manifest"
+
+	// SignatureSig is the base64 encoded ECDSA signature of the manifest.
+	SignatureSig = "signature.sig"
+
+	// SignatureBase is the ref of the image that a frontend was published on,
+	// pinned to a digest. It is listed in the manifest so that the signature
+	// also covers the frontend binary, which comes from the base image.
+	SignatureBase = "signature.base"
+)
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// LoadSigningKey loads a PEM encoded ECDSA private key, such as one generated
+// by `openssl ecparam -name prime256v1 -genkey -noout`.
+func LoadSigningKey(filename string) (*ecdsa.PrivateKey, error) {
+	dt, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(dt)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM encoded key", filename)
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: key is not an ECDSA key", filename)
+	}
+	return ecKey, nil
+}
+
+// LoadTrustedKeys loads the PEM encoded ECDSA public keys in a file, such as
+// ones written by `openssl ec -pubout`.
+func LoadTrustedKeys(filename string) ([]*ecdsa.PublicKey, error) {
+	dt, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*ecdsa.PublicKey
+	for {
+		var block *pem.Block
+		block, dt = pem.Decode(dt)
+		if block == nil {
+			break
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: key is not an ECDSA key", filename)
+		}
+		keys = append(keys, ecKey)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no PEM encoded keys", filename)
+	}
+	return keys, nil
+}
+
+// NewManifest returns the manifest of files by their path in a frontend.
+func NewManifest(files map[string][]byte) []byte {
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var b bytes.Buffer
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%x  %s\n", sha256.Sum256(files[p]), p)
+	}
+	return b.Bytes()
+}
+
+// SignManifest returns the signature of a manifest.
+func SignManifest(key *ecdsa.PrivateKey, manifest []byte) ([]byte, error) {
+	digest := sha256.Sum256(manifest)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := asn1.Marshal(ecdsaSignature{r, s})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), nil
+}
+
+// VerifyManifest returns an error if a manifest is not signed by any of the
+// trusted keys.
+func VerifyManifest(keys []*ecdsa.PublicKey, manifest, sig []byte) error {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+
+	var esig ecdsaSignature
+	_, err = asn1.Unmarshal(der, &esig)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+
+	digest := sha256.Sum256(manifest)
+	for _, key := range keys {
+		if ecdsa.Verify(key, digest[:], esig.R, esig.S) {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature is not from a trusted key")
+}
+
+// VerifyBundle verifies the files of a frontend downloaded to a directory.
+// The manifest must be signed by a trusted key, list the signatures and every
+// source, and match their digests.
+func VerifyBundle(dir string, keys []*ecdsa.PublicKey) error {
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, SignatureManifest))
+	if err != nil {
+		return err
+	}
+
+	sig, err := ioutil.ReadFile(filepath.Join(dir, SignatureSig))
+	if err != nil {
+		return err
+	}
+
+	err = VerifyManifest(keys, manifest, sig)
+	if err != nil {
+		return err
+	}
+
+	digests, err := parseManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range []string{SignatureHLB, SignatureBase} {
+		if _, ok := digests[p]; !ok {
+			return fmt.Errorf("manifest does not list %s", p)
+		}
+	}
+
+	// Unlisted sources would be run by the frontend without being signed.
+	err = filepath.Walk(filepath.Join(dir, SourcesDir), func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := digests[filepath.ToSlash(rel)]; !ok {
+			return fmt.Errorf("manifest does not list %s", filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for p, digest := range digests {
+		dt, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+
+		if fmt.Sprintf("%x", sha256.Sum256(dt)) != digest {
+			return fmt.Errorf("digest of %s does not match manifest", p)
+		}
+	}
+	return nil
+}
+
+// parseManifest returns the digests of a manifest by path.
+func parseManifest(manifest []byte) (map[string]string, error) {
+	digests := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid manifest line %q", scanner.Text())
+		}
+
+		digest, p := parts[0], parts[1]
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid digest for %s", p)
+		}
+
+		if path.IsAbs(p) || path.Clean(p) != p || strings.HasPrefix(p, "../") {
+			return nil, fmt.Errorf("invalid manifest path %q", p)
+		}
+		digests[p] = digest
+	}
+	return digests, scanner.Err()
+}
+
+// FetchFrontend downloads the signatures, sources and their signed manifest
+// from a frontend image to a directory.
+func FetchFrontend(ctx context.Context, cln *client.Client, ref, dir string) error {
+	image := llb.Image(ref)
+
+	fa := llb.Copy(image, "/"+SignatureHLB, "/"+SignatureHLB)
+	for _, p := range []string{SignatureBase, SignatureManifest, SignatureSig} {
+		fa = fa.Copy(image, "/"+p, "/"+p)
+	}
+	fa = fa.Copy(image, "/"+SourcesDir, "/"+SourcesDir, &llb.CopyInfo{
+		CopyDirContentsOnly: true,
+		CreateDestPath:      true,
+	})
+
+	err := solver.Solve(ctx, cln, llb.Scratch().File(fa), solver.WithDownload(dir))
+	if err != nil {
+		return fmt.Errorf("failed to fetch signed frontend %s: %s", ref, err)
+	}
+	return nil
+}
+
+// VerifyFrontend fetches a frontend image and verifies that it was signed by
+// a trusted key, and that it was published on the signed base image. The ref
+// must be pinned to a digest, so that the image that is verified is the image
+// that is run.
+func VerifyFrontend(ctx context.Context, cln *client.Client, ref string, keys []*ecdsa.PublicKey) error {
+	if !strings.Contains(ref, "@") {
+		return fmt.Errorf("frontend %s must be pinned to a digest to be verified", ref)
+	}
+
+	dir, err := ioutil.TempDir("", "hlb-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	err = FetchFrontend(ctx, cln, ref, dir)
+	if err != nil {
+		return err
+	}
+
+	err = VerifyBundle(dir, keys)
+	if err != nil {
+		return fmt.Errorf("frontend %s: %s", ref, err)
+	}
+
+	dt, err := ioutil.ReadFile(filepath.Join(dir, SignatureBase))
+	if err != nil {
+		return err
+	}
+
+	err = verifyBase(ctx, ref, strings.TrimSpace(string(dt)))
+	if err != nil {
+		return fmt.Errorf("frontend %s: %s", ref, err)
+	}
+	return nil
+}
+
+// verifyBase returns an error if a frontend image is not its signed base
+// image with one layer of published files on top, run with the config of the
+// base. The files in the layer are only checked through the manifest, so
+// anything else that could run in the frontend must come from the base.
+func verifyBase(ctx context.Context, ref, base string) error {
+	if !strings.Contains(base, "@") {
+		return fmt.Errorf("base image %s is not pinned to a digest", base)
+	}
+
+	img, err := ImageConfig(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	baseImg, err := ImageConfig(ctx, base)
+	if err != nil {
+		return err
+	}
+
+	return verifyImage(img, baseImg)
+}
+
+// verifyImage returns an error if an image config doesn't have exactly one
+// layer on top of the layers of a base image config, or would run differently
+// from the base.
+func verifyImage(img, base *specs.Image) error {
+	layers, baseLayers := img.RootFS.DiffIDs, base.RootFS.DiffIDs
+	if len(layers) != len(baseLayers)+1 {
+		return fmt.Errorf("image does not have exactly one layer on top of its base image")
+	}
+	for i, layer := range baseLayers {
+		if layers[i] != layer {
+			return fmt.Errorf("image is not based on its base image")
+		}
+	}
+
+	config, baseConfig := img.Config, base.Config
+	if !reflect.DeepEqual(config.Entrypoint, baseConfig.Entrypoint) ||
+		!reflect.DeepEqual(config.Cmd, baseConfig.Cmd) ||
+		!reflect.DeepEqual(config.Env, baseConfig.Env) ||
+		config.User != baseConfig.User ||
+		config.WorkingDir != baseConfig.WorkingDir {
+		return fmt.Errorf("image config does not match its base image")
+	}
+	return nil
+}
+
+// FrontendRefs returns the image refs of the frontends generated in a checked
+// AST. Frontends that aren't an image literal can't be verified, so they are
+// errors.
+func FrontendRefs(root *ast.AST) ([]string, error) {
+	lits, err := frontendLits(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	seen := make(map[string]struct{})
+	for _, lit := range lits {
+		if _, ok := seen[*lit.Str]; !ok {
+			seen[*lit.Str] = struct{}{}
+			refs = append(refs, *lit.Str)
+		}
+	}
+	return refs, nil
+}
+
+// PinFrontends replaces the image refs of the frontends generated in a checked
+// AST with their pinned refs, so that the frontends that are generated are the
+// frontends that were verified.
+func PinFrontends(root *ast.AST, pinned map[string]string) error {
+	lits, err := frontendLits(root)
+	if err != nil {
+		return err
+	}
+
+	for _, lit := range lits {
+		if ref, ok := pinned[*lit.Str]; ok {
+			lit.Str = &ref
+		}
+	}
+	return nil
+}
+
+// frontendLits returns the image literals of the frontends generated in a
+// checked AST.
+func frontendLits(root *ast.AST) ([]*ast.BasicLit, error) {
+	var (
+		lits []*ast.BasicLit
+		err  error
+	)
+	ast.Inspect(root, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallStmt)
+		if !ok || call.Func.Name != "generate" || len(call.Args) == 0 || err != nil {
+			return err == nil
+		}
+
+		lit, ok := imageLit(call.Args[0])
+		if !ok {
+			err = fmt.Errorf("%s cannot verify a frontend that is not an image literal", report.FormatPos(call.Args[0].Position()))
+			return false
+		}
+
+		lits = append(lits, lit)
+		return true
+	})
+	return lits, err
+}
+
+// imageLit returns the ref literal of a fs block literal that is only an
+// image.
+func imageLit(expr *ast.Expr) (*ast.BasicLit, bool) {
+	if expr.BlockLit == nil {
+		return nil, false
+	}
+
+	stmts := expr.BlockLit.Body.NonEmptyStmts()
+	if len(stmts) != 1 || stmts[0].Call == nil {
+		return nil, false
+	}
+
+	call := stmts[0].Call
+	if call.Func.Name != "image" || call.WithOpt != nil || len(call.Args) != 1 {
+		return nil, false
+	}
+
+	lit := call.Args[0].BasicLit
+	if lit == nil || lit.Str == nil {
+		return nil, false
+	}
+	return lit, true
+}
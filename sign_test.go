@@ -0,0 +1,275 @@
+package hlb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyBundle(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "hlb-sign")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "key.pem")
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	pubFile := filepath.Join(dir, "trusted.pem")
+	writePEM(t, pubFile, "PUBLIC KEY", pubDER)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signingKey, err := LoadSigningKey(keyFile)
+	require.NoError(t, err)
+
+	trusted, err := LoadTrustedKeys(pubFile)
+	require.NoError(t, err)
+	require.Len(t, trusted, 1)
+
+	files := map[string][]byte{
+		SignatureHLB:        []byte("fs build() { generate fs { image \"build\"; }; }\n"),
+		SignatureBase:       []byte("openllb/hlb@sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945\n"),
+		"sources/build.hlb": []byte("fs build() { image \"alpine\"; }\n"),
+		"sources/lib/a.hlb": []byte("fs a() { scratch; }\n"),
+	}
+
+	for _, tc := range []struct {
+		name   string
+		keys   []*ecdsa.PublicKey
+		tamper func(bundle string)
+		err    string
+	}{{
+		"signed",
+		trusted,
+		nil,
+		"",
+	}, {
+		"untrusted key",
+		[]*ecdsa.PublicKey{&other.PublicKey},
+		nil,
+		"signature is not from a trusted key",
+	}, {
+		"modified source",
+		trusted,
+		func(bundle string) {
+			writeFile(t, filepath.Join(bundle, "sources/build.hlb"), "fs build() { image \"evil\"; }\n")
+		},
+		"digest of sources/build.hlb does not match manifest",
+	}, {
+		"unlisted source",
+		trusted,
+		func(bundle string) {
+			writeFile(t, filepath.Join(bundle, "sources/evil.hlb"), "fs evil() { scratch; }\n")
+		},
+		"manifest does not list sources/evil.hlb",
+	}, {
+		"modified base",
+		trusted,
+		func(bundle string) {
+			writeFile(t, filepath.Join(bundle, SignatureBase), "openllb/hlb:latest\n")
+		},
+		"digest of signature.base does not match manifest",
+	}, {
+		"modified manifest",
+		trusted,
+		func(bundle string) {
+			writeFile(t, filepath.Join(bundle, SignatureManifest), "")
+		},
+		"signature is not from a trusted key",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			bundle := filepath.Join(dir, strings.Replace(tc.name, " ", "-", -1))
+			for p, dt := range files {
+				writeFile(t, filepath.Join(bundle, p), string(dt))
+			}
+
+			manifest := NewManifest(files)
+			sig, err := SignManifest(signingKey, manifest)
+			require.NoError(t, err)
+			writeFile(t, filepath.Join(bundle, SignatureManifest), string(manifest))
+			writeFile(t, filepath.Join(bundle, SignatureSig), string(sig))
+
+			if tc.tamper != nil {
+				tc.tamper(bundle)
+			}
+
+			err = VerifyBundle(bundle, tc.keys)
+			if tc.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestFrontendRefs(t *testing.T) {
+	t.Parallel()
+
+	files, ibs, err := ParseMultiple([]io.Reader{strings.NewReader(`
+fs build() {
+	generate fs { image "openllb/build:v1.0.0"; } with option {
+		frontendOpt "hlb-target" "build"
+	}
+}
+
+fs test() {
+	generate fs { image "openllb/build:v1.0.0"; }
+}
+`)})
+	require.NoError(t, err)
+
+	root, err := Check(files, ibs)
+	require.NoError(t, err)
+
+	refs, err := FrontendRefs(root)
+	require.NoError(t, err)
+	require.Equal(t, []string{"openllb/build:v1.0.0"}, refs)
+
+	pinned := "openllb/build:v1.0.0@sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945"
+	err = PinFrontends(root, map[string]string{"openllb/build:v1.0.0": pinned})
+	require.NoError(t, err)
+
+	refs, err = FrontendRefs(root)
+	require.NoError(t, err)
+	require.Equal(t, []string{pinned}, refs)
+
+	files, ibs, err = ParseMultiple([]io.Reader{strings.NewReader(`
+fs frontend() {
+	image "openllb/build"
+}
+
+fs build() {
+	generate frontend
+}
+`)})
+	require.NoError(t, err)
+
+	root, err = Check(files, ibs)
+	require.NoError(t, err)
+
+	_, err = FrontendRefs(root)
+	require.Error(t, err)
+}
+
+func TestVerifyImage(t *testing.T) {
+	t.Parallel()
+
+	base := &specs.Image{
+		Config: specs.ImageConfig{
+			Entrypoint: []string{"/run"},
+			Env:        []string{"PATH=/bin"},
+		},
+		RootFS: specs.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{digest.FromString("base")},
+		},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		tamper func(img *specs.Image)
+		err    string
+	}{{
+		"published",
+		nil,
+		"",
+	}, {
+		"extra layer",
+		func(img *specs.Image) {
+			img.RootFS.DiffIDs = append(img.RootFS.DiffIDs, digest.FromString("evil"))
+		},
+		"image does not have exactly one layer on top of its base image",
+	}, {
+		"different base",
+		func(img *specs.Image) {
+			img.RootFS.DiffIDs[0] = digest.FromString("other")
+		},
+		"image is not based on its base image",
+	}, {
+		"modified entrypoint",
+		func(img *specs.Image) {
+			img.Config.Entrypoint = []string{"/evil"}
+		},
+		"image config does not match its base image",
+	}, {
+		"added cmd",
+		func(img *specs.Image) {
+			img.Config.Cmd = []string{"/evil"}
+		},
+		"image config does not match its base image",
+	}, {
+		"modified env",
+		func(img *specs.Image) {
+			img.Config.Env = []string{"PATH=/evil"}
+		},
+		"image config does not match its base image",
+	}, {
+		"modified user",
+		func(img *specs.Image) {
+			img.Config.User = "root"
+		},
+		"image config does not match its base image",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			img := &specs.Image{
+				Config: specs.ImageConfig{
+					Entrypoint: []string{"/run"},
+					Env:        []string{"PATH=/bin"},
+				},
+				RootFS: specs.RootFS{
+					Type:    "layers",
+					DiffIDs: []digest.Digest{digest.FromString("base"), digest.FromString("sources")},
+				},
+			}
+			if tc.tamper != nil {
+				tc.tamper(img)
+			}
+
+			err := verifyImage(img, base)
+			if tc.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func writePEM(t *testing.T, filename, typ string, der []byte) {
+	writeFile(t, filename, string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})))
+}
+
+func writeFile(t *testing.T, filename, content string) {
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filename, []byte(content), 0644)
+	require.NoError(t, err)
+}
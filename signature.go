@@ -0,0 +1,142 @@
+package hlb
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/openllb/hlb/ast"
+)
+
+const (
+	// OptVersion is the frontend opt that signatures pass the version they
+	// were published with in.
+	OptVersion = "hlb-version"
+)
+
+var versionRegexp = regexp.MustCompile(`^v(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// ValidVersion returns whether v is a semantic version with a "v" prefix, such
+// as v1.2.3.
+func ValidVersion(v string) bool {
+	return versionRegexp.MatchString(v)
+}
+
+// SignatureVersion returns the version that a signature file was published
+// with, or an empty string if it was published without one.
+func SignatureVersion(file *ast.File) string {
+	var version string
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallStmt)
+		if !ok || call.Func.Name != "frontendOpt" || len(call.Args) != 2 {
+			return true
+		}
+
+		key, value := call.Args[0].BasicLit, call.Args[1].BasicLit
+		if key == nil || key.Str == nil || value == nil || value.Str == nil {
+			return true
+		}
+
+		if *key.Str == OptVersion {
+			version = *value.Str
+			return false
+		}
+		return true
+	})
+	return version
+}
+
+// SignatureChange is a function whose declaration changed between two
+// versions of a signature file. Old is nil for added functions and New is nil
+// for removed functions.
+type SignatureChange struct {
+	Name string
+	Old  *ast.FuncDecl
+	New  *ast.FuncDecl
+}
+
+// Breaking returns whether calls to the old function may be incompatible with
+// the new function. Renaming params is compatible because args are passed by
+// position.
+func (c SignatureChange) Breaking() bool {
+	switch {
+	case c.Old == nil:
+		return false
+	case c.New == nil:
+		return true
+	default:
+		return callSignature(c.Old) != callSignature(c.New)
+	}
+}
+
+func (c SignatureChange) String() string {
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("added %s", funcHeader(c.New))
+	case c.New == nil:
+		return fmt.Sprintf("removed %s", funcHeader(c.Old))
+	default:
+		return fmt.Sprintf("changed %s to %s", funcHeader(c.Old), funcHeader(c.New))
+	}
+}
+
+// DiffSignatures returns the functions whose declarations changed from an old
+// to a new signature file, sorted by name.
+func DiffSignatures(old, new *ast.File) []SignatureChange {
+	oldFuncs, newFuncs := signatureFuncs(old), signatureFuncs(new)
+
+	var changes []SignatureChange
+	for name, oldFun := range oldFuncs {
+		newFun := newFuncs[name]
+		if newFun != nil && funcHeader(oldFun) == funcHeader(newFun) {
+			continue
+		}
+		changes = append(changes, SignatureChange{name, oldFun, newFun})
+	}
+
+	for name, newFun := range newFuncs {
+		if _, ok := oldFuncs[name]; !ok {
+			changes = append(changes, SignatureChange{name, nil, newFun})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+func signatureFuncs(file *ast.File) map[string]*ast.FuncDecl {
+	funcs := make(map[string]*ast.FuncDecl)
+	for _, decl := range file.Decls {
+		if decl.Func != nil {
+			funcs[decl.Func.Name.Name] = decl.Func
+		}
+	}
+	return funcs
+}
+
+// funcHeader returns the declaration of a function without its body.
+func funcHeader(fun *ast.FuncDecl) string {
+	params := "()"
+	if fun.Params != nil {
+		params = fun.Params.String()
+	}
+	return fmt.Sprintf("%s %s%s", fun.Type, fun.Name, params)
+}
+
+// callSignature returns the types that calls to a function depend on.
+func callSignature(fun *ast.FuncDecl) string {
+	var params []string
+	if fun.Params != nil {
+		for _, field := range fun.Params.List {
+			param := field.Type.String()
+			if field.Variadic != nil {
+				param = fmt.Sprintf("%s %s", field.Variadic, param)
+			}
+			params = append(params, param)
+		}
+	}
+	return fmt.Sprintf("%s(%s)", fun.Type, strings.Join(params, ", "))
+}
@@ -0,0 +1,87 @@
+package hlb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidVersion(t *testing.T) {
+	t.Parallel()
+
+	for version, expected := range map[string]bool{
+		"v1.2.3":         true,
+		"v0.0.1":         true,
+		"v1.0.0-rc.1":    true,
+		"v1.0.0+build.5": true,
+		"1.2.3":          false,
+		"v1.2":           false,
+		"v01.2.3":        false,
+		"latest":         false,
+		"":               false,
+	} {
+		require.Equal(t, expected, ValidVersion(version), version)
+	}
+}
+
+func TestSignatureVersion(t *testing.T) {
+	t.Parallel()
+
+	file, _, err := Parse(strings.NewReader(`
+fs build(string ref) {
+	generate fs { image "openllb/build:v1.2.0"; } with option {
+		frontendOpt "hlb-target" "build"
+		frontendOpt "hlb-version" "v1.2.0"
+		frontendOpt "ref" ref
+	}
+}
+`))
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.0", SignatureVersion(file))
+
+	file, _, err = Parse(strings.NewReader(`
+fs build() {
+	generate fs { image "openllb/build"; } with option {
+		frontendOpt "hlb-target" "build"
+	}
+}
+`))
+	require.NoError(t, err)
+	require.Empty(t, SignatureVersion(file))
+}
+
+func TestDiffSignatures(t *testing.T) {
+	t.Parallel()
+
+	old, _, err := Parse(strings.NewReader(`
+fs build(string ref) { image ref; }
+fs lint(string src) { image src; }
+fs test(string ref, int n) { image ref; }
+fs unchanged() { image "alpine"; }
+`))
+	require.NoError(t, err)
+
+	updated, _, err := Parse(strings.NewReader(`
+fs build(string name) { image name; }
+fs test(string ref, string n) { image ref; }
+fs unchanged() { image "busybox"; }
+fs release() { image "alpine"; }
+`))
+	require.NoError(t, err)
+
+	var actual []string
+	for _, change := range DiffSignatures(old, updated) {
+		actual = append(actual, change.String())
+		if change.Breaking() {
+			actual[len(actual)-1] += " (breaking)"
+		}
+	}
+
+	require.Equal(t, []string{
+		"changed fs build(string ref) to fs build(string name)",
+		"removed fs lint(string src) (breaking)",
+		"added fs release()",
+		"changed fs test(string ref, int n) to fs test(string ref, string n) (breaking)",
+	}, actual)
+}
@@ -28,6 +28,7 @@ type SolveInfo struct {
 	OutputPushImage    string
 	OutputLocal        string
 	OutputLocalTarball bool
+	ImageSpec          *specs.Image
 	Locals             map[string]string
 }
 
@@ -62,6 +63,13 @@ func WithPushImage(ref string) SolveOption {
 	}
 }
 
+func WithImageSpec(spec *specs.Image) SolveOption {
+	return func(info *SolveInfo) error {
+		info.ImageSpec = spec
+		return nil
+	}
+}
+
 func WithDownload(dest string) SolveOption {
 	return func(info *SolveInfo) error {
 		info.OutputLocal = dest
@@ -176,15 +184,12 @@ func Solve(ctx context.Context, c *client.Client, st llb.State, opts ...SolveOpt
 			}
 
 			if _, ok := res.Metadata[exptypes.ExporterImageConfigKey]; !ok {
-				img := specs.Image{
-					Config: specs.ImageConfig{
-						Env:        st.Env(),
-						Entrypoint: st.GetArgs(),
-						WorkingDir: st.GetDir(),
-					},
+				var config []byte
+				if info.ImageSpec != nil {
+					config, err = json.Marshal(info.ImageSpec)
+				} else {
+					config, err = ImageConfig(st, specs.Platform{})
 				}
-
-				config, err := json.Marshal(img)
 				if err != nil {
 					return nil, err
 				}
@@ -223,3 +228,74 @@ func Solve(ctx context.Context, c *client.Client, st llb.State, opts ...SolveOpt
 
 	return nil
 }
+
+// Build solves the given states through the BuildKit gateway and calls f with
+// a reference to each resulting filesystem. References are only valid until f
+// returns, and a reference is nil if its state is an empty filesystem. Only
+// the locals of the given options are used.
+func Build(ctx context.Context, c *client.Client, sts []llb.State, f func(ctx context.Context, refs []gateway.Reference) error, opts ...SolveOption) error {
+	info := SolveInfo{
+		Locals: make(map[string]string),
+	}
+	for _, opt := range opts {
+		err := opt(&info)
+		if err != nil {
+			return err
+		}
+	}
+
+	var defs []*llb.Definition
+	for _, st := range sts {
+		def, err := st.Marshal(llb.LinuxAmd64)
+		if err != nil {
+			return err
+		}
+		defs = append(defs, def)
+	}
+
+	solveOpt := client.SolveOpt{
+		Session:   []session.Attachable{authprovider.NewDockerAuthProvider(os.Stderr)},
+		LocalDirs: info.Locals,
+	}
+
+	_, err := c.Build(ctx, solveOpt, "", func(ctx context.Context, c gateway.Client) (*gateway.Result, error) {
+		var refs []gateway.Reference
+		for _, def := range defs {
+			res, err := c.Solve(ctx, gateway.SolveRequest{
+				Definition: def.ToPB(),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			ref, err := res.SingleRef()
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, ref)
+		}
+
+		err := f(ctx, refs)
+		if err != nil {
+			return nil, err
+		}
+
+		return gateway.NewResult(), nil
+	}, nil)
+	return err
+}
+
+// ImageConfig returns the JSON image config of a state for a platform, with
+// the environment, args and working directory set on the state.
+func ImageConfig(st llb.State, platform specs.Platform) ([]byte, error) {
+	img := specs.Image{
+		Architecture: platform.Architecture,
+		OS:           platform.OS,
+		Config: specs.ImageConfig{
+			Env:        st.Env(),
+			Entrypoint: st.GetArgs(),
+			WorkingDir: st.GetDir(),
+		},
+	}
+	return json.Marshal(img)
+}
@@ -0,0 +1,330 @@
+package hlb
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/client/llb"
+	gateway "github.com/moby/buildkit/frontend/gateway/client"
+	"github.com/openllb/hlb/ast"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/report"
+	"github.com/openllb/hlb/solver"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// TestPrefix is the prefix of the name of fs functions that are tests.
+	TestPrefix = "test_"
+)
+
+type TestOption func(*TestInfo) error
+
+type TestInfo struct {
+	Run      *regexp.Regexp
+	Parallel int
+}
+
+// WithTestRun only runs tests whose name matches the regular expression.
+func WithTestRun(run *regexp.Regexp) TestOption {
+	return func(i *TestInfo) error {
+		i.Run = run
+		return nil
+	}
+}
+
+// WithTestParallel limits the number of tests solved at the same time.
+func WithTestParallel(parallel int) TestOption {
+	return func(i *TestInfo) error {
+		if parallel < 1 {
+			return fmt.Errorf("parallel must be at least 1, found %d", parallel)
+		}
+		i.Parallel = parallel
+		return nil
+	}
+}
+
+// TestResult is the outcome of a single test. A test passes if its filesystem
+// and every assertion in it solves, and Err is nil.
+type TestResult struct {
+	Name     string
+	Pos      lexer.Position
+	Duration time.Duration
+	Err      error
+}
+
+// Passed returns whether the test passed.
+func (r *TestResult) Passed() bool {
+	return r.Err == nil
+}
+
+// Test discovers the tests in the given HLB programs, then compiles and solves
+// them. A test is a fs function without parameters whose name starts with
+// TestPrefix. Tests fail if their filesystem fails to solve, or if any of their
+// assert statements fail.
+//
+// Results are returned in the order tests are declared.
+func Test(ctx context.Context, cln *client.Client, rs []io.Reader, opts ...TestOption) ([]*TestResult, error) {
+	info := TestInfo{
+		Parallel: 4,
+	}
+	for _, opt := range opts {
+		err := opt(&info)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files, ibs, err := ParseMultiple(rs, defaultOpts()...)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := Check(files, ibs, defaultOpts()...)
+	if err != nil {
+		return nil, err
+	}
+
+	funs := discoverTests(root, info.Run)
+
+	// Code generation shares scopes so it must happen one test at a time,
+	// before solving the tests in parallel.
+	results := make([]*TestResult, len(funs))
+	sts := make([]llb.State, len(funs))
+	infos := make([]*codegen.CodeGenInfo, len(funs))
+	for i, fun := range funs {
+		results[i] = &TestResult{
+			Name: fun.Name.Name,
+			Pos:  fun.Pos,
+		}
+
+		call := &ast.CallStmt{
+			Func: &ast.Ident{Name: fun.Name.Name},
+		}
+
+		sts[i], infos[i], results[i].Err = codegen.Generate(call, root)
+	}
+
+	sem := make(chan struct{}, info.Parallel)
+
+	g, ctx := errgroup.WithContext(ctx)
+	for i := range funs {
+		i := i
+		if results[i].Err != nil {
+			continue
+		}
+
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			results[i].Err = runTest(ctx, cln, sts[i], infos[i])
+			results[i].Duration = time.Since(start)
+			return nil
+		})
+	}
+
+	return results, g.Wait()
+}
+
+func discoverTests(root *ast.AST, run *regexp.Regexp) []*ast.FuncDecl {
+	var funs []*ast.FuncDecl
+	for _, obj := range root.Scope.Defined(ast.DeclKind) {
+		fun, ok := obj.Node.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+
+		name := fun.Name.Name
+		if !strings.HasPrefix(name, TestPrefix) ||
+			fun.Type.Type() != ast.Filesystem ||
+			fun.Params.NumFields() > 0 {
+			continue
+		}
+
+		if run != nil && !run.MatchString(name) {
+			continue
+		}
+
+		funs = append(funs, fun)
+	}
+
+	sort.SliceStable(funs, func(i, j int) bool {
+		pi, pj := funs[i].Pos, funs[j].Pos
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+	return funs
+}
+
+func runTest(ctx context.Context, cln *client.Client, st llb.State, info *codegen.CodeGenInfo) error {
+	var solveOpts []solver.SolveOption
+	for id, path := range info.Locals {
+		solveOpts = append(solveOpts, solver.WithLocal(id, path))
+	}
+
+	noop := func(_ context.Context, _ []gateway.Reference) error {
+		return nil
+	}
+
+	err := solver.Build(ctx, cln, []llb.State{st}, noop, solveOpts...)
+	if err != nil {
+		return err
+	}
+
+	for _, assertion := range info.Assertions {
+		assertion := assertion
+		err = solver.Build(ctx, cln, []llb.State{assertion.State}, func(ctx context.Context, refs []gateway.Reference) error {
+			return checkAssertion(ctx, assertion, refs[0])
+		}, solveOpts...)
+		if err != nil {
+			return fmt.Errorf("%s %s: %s", report.FormatPos(assertion.Call.Pos), assertion, err)
+		}
+	}
+
+	return nil
+}
+
+func checkAssertion(ctx context.Context, assertion *codegen.Assertion, ref gateway.Reference) error {
+	if assertion.Path == "" {
+		return nil
+	}
+
+	if ref == nil {
+		return fmt.Errorf("%s: no such file or directory", assertion.Path)
+	}
+
+	_, err := ref.StatFile(ctx, gateway.StatRequest{
+		Path: assertion.Path,
+	})
+	if err != nil {
+		return err
+	}
+
+	if assertion.Content == nil {
+		return nil
+	}
+
+	dt, err := ref.ReadFile(ctx, gateway.ReadRequest{
+		Filename: assertion.Path,
+	})
+	if err != nil {
+		return err
+	}
+
+	if string(dt) != *assertion.Content {
+		return fmt.Errorf("expected content %q, found %q", *assertion.Content, dt)
+	}
+	return nil
+}
+
+// WriteTAP writes test results in the Test Anything Protocol version 13.
+func WriteTAP(w io.Writer, results []*TestResult) error {
+	fmt.Fprintf(w, "TAP version 13\n")
+	fmt.Fprintf(w, "1..%d\n", len(results))
+
+	for i, result := range results {
+		if result.Passed() {
+			fmt.Fprintf(w, "ok %d - %s\n", i+1, result.Name)
+			continue
+		}
+
+		fmt.Fprintf(w, "not ok %d - %s\n", i+1, result.Name)
+		fmt.Fprintf(w, "  ---\n")
+		fmt.Fprintf(w, "  at: %q\n", strings.TrimSuffix(report.FormatPos(result.Pos), ":"))
+		fmt.Fprintf(w, "  message: |\n")
+		for _, line := range strings.Split(result.Err.Error(), "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+		fmt.Fprintf(w, "  ...\n")
+	}
+
+	return nil
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name         `xml:"testsuite"`
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Time      string           `xml:"time,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// WriteJUnit writes test results as a JUnit XML test suite.
+func WriteJUnit(w io.Writer, results []*TestResult) error {
+	suite := &junitTestSuite{
+		Name:  "hlb",
+		Tests: len(results),
+	}
+
+	var total time.Duration
+	for _, result := range results {
+		total += result.Duration
+
+		tc := &junitTestCase{
+			Name:      result.Name,
+			ClassName: result.Pos.Filename,
+			File:      result.Pos.Filename,
+			Line:      result.Pos.Line,
+			Time:      junitTime(result.Duration),
+		}
+
+		if !result.Passed() {
+			suite.Failures++
+
+			msg := result.Err.Error()
+			tc.Failure = &junitFailure{
+				Message:  strings.SplitN(msg, "\n", 2)[0],
+				Contents: msg,
+			}
+		}
+
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Time = junitTime(total)
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(suite)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
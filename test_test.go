@@ -0,0 +1,103 @@
+package hlb
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/openllb/hlb/report"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverTests(t *testing.T) {
+	t.Parallel()
+	file, _, err := Parse(strings.NewReader(`
+		fs test_b() {
+			scratch
+			assertExists "b"
+		}
+		fs test_a() {
+			image "alpine"
+			assertRun "true"
+			assertContent "/etc/alpine-release" "3.11.0"
+		}
+		fs test_args(string foo) {
+			scratch
+		}
+		fs helper() {
+			scratch
+		}
+	`))
+	require.NoError(t, err)
+
+	root, err := report.SemanticCheck(file)
+	require.NoError(t, err)
+
+	var names []string
+	for _, fun := range discoverTests(root, nil) {
+		names = append(names, fun.Name.Name)
+	}
+	require.Equal(t, []string{"test_b", "test_a"}, names)
+
+	names = nil
+	for _, fun := range discoverTests(root, regexp.MustCompile("_a$")) {
+		names = append(names, fun.Name.Name)
+	}
+	require.Equal(t, []string{"test_a"}, names)
+}
+
+func TestWriteTAP(t *testing.T) {
+	t.Parallel()
+	results := []*TestResult{
+		{Name: "test_a"},
+		{
+			Name: "test_b",
+			Pos:  lexer.Position{Filename: "test.hlb", Line: 3, Column: 1},
+			Err:  errors.New("test.hlb:5:2: assertExists \"b\": b: no such file or directory"),
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WriteTAP(&buf, results)
+	require.NoError(t, err)
+	require.Equal(t, `TAP version 13
+1..2
+ok 1 - test_a
+not ok 2 - test_b
+  ---
+  at: "test.hlb:3:1"
+  message: |
+    test.hlb:5:2: assertExists "b": b: no such file or directory
+  ...
+`, buf.String())
+}
+
+func TestWriteJUnit(t *testing.T) {
+	t.Parallel()
+	results := []*TestResult{
+		{
+			Name: "test_a",
+			Pos:  lexer.Position{Filename: "test.hlb", Line: 1, Column: 1},
+		},
+		{
+			Name: "test_b",
+			Pos:  lexer.Position{Filename: "test.hlb", Line: 3, Column: 1},
+			Err:  errors.New("failed"),
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WriteJUnit(&buf, results)
+	require.NoError(t, err)
+	require.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuite name="hlb" tests="2" failures="1" time="0.000">
+  <testcase name="test_a" classname="test.hlb" file="test.hlb" line="1" time="0.000"></testcase>
+  <testcase name="test_b" classname="test.hlb" file="test.hlb" line="3" time="0.000">
+    <failure message="failed">failed</failure>
+  </testcase>
+</testsuite>
+`, buf.String())
+}
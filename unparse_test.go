@@ -20,43 +20,43 @@ func cleanup(value string) string {
 	return result
 }
 
-func TestUnparse(t *testing.T) {
-	for _, tc := range []testCase{
-		{
-			"empty",
-			``,
-			``,
-		},
-		{
-			"regular",
-			`
+// unparseTestCases is also the corpus for the formatter's property tests.
+var unparseTestCases = []testCase{
+	{
+		"empty",
+		``,
+		``,
+	},
+	{
+		"regular",
+		`
 			fs foo() { scratch; }
 			`,
-			`
+		`
 			fs foo() { scratch; }
 			`,
-		},
-		{
-			"no space",
-			`
+	},
+	{
+		"no space",
+		`
 			fs foo(){scratch;}
 			`,
-			`
+		`
 			fs foo() { scratch; }
 			`,
-		},
-		{
-			"extra tabs and spaces",
-			`
+	},
+	{
+		"extra tabs and spaces",
+		`
 			fs foo   () 	{    scratch; }
 			`,
-			`
+		`
 			fs foo() { scratch; }
 			`,
-		},
-		{
-			"extra newlines",
-			`
+	},
+	{
+		"extra newlines",
+		`
 
 
 			fs foo() {
@@ -68,67 +68,67 @@ func TestUnparse(t *testing.T) {
 			}
 
 			`,
-			`
+		`
 			fs foo() {
 
 				scratch
 
 			}
 			`,
-		},
-		{
-			"extra tabs",
-			`
+	},
+	{
+		"extra tabs",
+		`
 			fs foo() {
 							scratch
 			}
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
 			`,
-		},
-		{
-			"source newlined",
-			`
+	},
+	{
+		"source newlined",
+		`
 			fs foo() {
 			scratch; }
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
 			`,
-		},
-		{
-			"block end newlined",
-			`
+	},
+	{
+		"block end newlined",
+		`
 			fs foo() { scratch
 			}
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
 			`,
-		},
-		{
-			"regular newlined",
-			`
+	},
+	{
+		"regular newlined",
+		`
 			fs foo() {
 				scratch
 			}
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
 			`,
-		},
-		{
-			"regular entries",
-			`
+	},
+	{
+		"regular entries",
+		`
 			fs foo() {
 				scratch
 			}
@@ -137,7 +137,7 @@ func TestUnparse(t *testing.T) {
 				scratch
 			}
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
@@ -146,10 +146,10 @@ func TestUnparse(t *testing.T) {
 				scratch
 			}
 			`,
-		},
-		{
-			"entries extra newlines",
-			`
+	},
+	{
+		"entries extra newlines",
+		`
 
 
 			fs foo() {
@@ -162,7 +162,7 @@ func TestUnparse(t *testing.T) {
 				scratch
 			}
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
@@ -171,10 +171,10 @@ func TestUnparse(t *testing.T) {
 				scratch
 			}
 			`,
-		},
-		{
-			"mixed inline newline entries",
-			`
+	},
+	{
+		"mixed inline newline entries",
+		`
 			fs foo() {
 				scratch
 			}
@@ -185,7 +185,7 @@ func TestUnparse(t *testing.T) {
 				scratch
 			}
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
@@ -196,10 +196,10 @@ func TestUnparse(t *testing.T) {
 				scratch
 			}
 			`,
-		},
-		{
-			"entries too close",
-			`
+	},
+	{
+		"entries too close",
+		`
 			fs foo() {
 				scratch
 			}
@@ -207,7 +207,7 @@ func TestUnparse(t *testing.T) {
 				scratch
 			}
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
@@ -216,17 +216,17 @@ func TestUnparse(t *testing.T) {
 				scratch
 			}
 			`,
-		},
-		{
-			"entries over",
-			`
+	},
+	{
+		"entries over",
+		`
 			fs foo() {
 				scratch
 			} fs bar() {
 				scratch
 			}
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
@@ -235,62 +235,62 @@ func TestUnparse(t *testing.T) {
 				scratch
 			}
 			`,
-		},
-		{
-			"entries over inlined",
-			`
+	},
+	{
+		"entries over inlined",
+		`
 			fs foo() {
 				scratch
 			} fs bar() { scratch; }
 			`,
-			`
+		`
 			fs foo() {
 				scratch
 			}
 
 			fs bar() { scratch; }
 			`,
-		},
-		{
-			"inlined entries",
-			`
+	},
+	{
+		"inlined entries",
+		`
 			fs foo() { scratch; } fs bar() { scratch; }
 			`,
-			`
+		`
 			fs foo() { scratch; } fs bar() { scratch; }
 			`,
-		},
-		{
-			"inlined over newlined entry",
-			`
+	},
+	{
+		"inlined over newlined entry",
+		`
 			fs foo() { scratch; } fs bar() {
 				scratch
 			}
 			`,
-			`
+		`
 			fs foo() { scratch; }
 
 			fs bar() {
 				scratch
 			}
 			`,
-		},
-		{
-			"entry with op",
-			`
+	},
+	{
+		"entry with op",
+		`
 			fs foo() {
 				image "alpine"
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine"
 			}
 			`,
-		},
-		{
-			"entry with multiple ops",
-			`
+	},
+	{
+		"entry with multiple ops",
+		`
 			fs foo() {
 				image "alpine"
 				env "key" "value"
@@ -298,7 +298,7 @@ func TestUnparse(t *testing.T) {
 				env "key" "value"
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine"
 				env "key" "value"
@@ -306,111 +306,111 @@ func TestUnparse(t *testing.T) {
 				env "key" "value"
 			}
 			`,
-		},
-		{
-			"entry with mixed inline ops",
-			`
+	},
+	{
+		"entry with mixed inline ops",
+		`
 			fs foo() {
 				image "alpine"
 				env "key" "value"; env "key" "value"
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine"
 				env "key" "value"
 				env "key" "value"
 			}
 			`,
-		},
-		{
-			"inlined entry with ops",
-			`
+	},
+	{
+		"inlined entry with ops",
+		`
 			fs foo() { image "alpine"; env "key" "value"; env "key" "value"; }
 			`,
-			`
+		`
 			fs foo() { image "alpine"; env "key" "value"; env "key" "value"; }
 			`,
-		},
-		{
-			"option identifier",
-			`
+	},
+	{
+		"option identifier",
+		`
 			fs foo() {
 				image "alpine" with foo
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine" with foo
 			}
 			`,
-		},
-		{
-			"empty option block",
-			`
+	},
+	{
+		"empty option block",
+		`
 			fs foo() {
 				image "alpine" with option {}
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine"
 			}
 			`,
-		},
-		{
-			"option block",
-			`
+	},
+	{
+		"option block",
+		`
 			fs foo() {
 				image "alpine" with option {
 					resolve
 				}
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine" with option {
 					resolve
 				}
 			}
 			`,
-		},
-		{
-			"inlined option block",
-			`
+	},
+	{
+		"inlined option block",
+		`
 			fs foo() {
 				image "alpine" with option { resolve; }
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine" with option { resolve; }
 			}
 			`,
-		},
-		{
-			"inlined option block with inlined op",
-			`
+	},
+	{
+		"inlined option block with inlined op",
+		`
 			fs foo() {
 				image "alpine" with option { resolve; }; env "key" "value"
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine" with option { resolve; }
 				env "key" "value"
 			}
 			`,
-		},
-		{
-			"option block field newlined",
-			`
+	},
+	{
+		"option block field newlined",
+		`
 			fs foo() {
 				image "alpine" with option {
 				resolve; }; env "key" "value"
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine" with option {
 					resolve
@@ -418,16 +418,16 @@ func TestUnparse(t *testing.T) {
 				env "key" "value"
 			}
 			`,
-		},
-		{
-			"option block end newlined",
-			`
+	},
+	{
+		"option block end newlined",
+		`
 			fs foo() {
 				image "alpine" with option { resolve
 				}; env "key" "value"
 			}
 			`,
-			`
+		`
 			fs foo() {
 				image "alpine" with option {
 					resolve
@@ -435,10 +435,10 @@ func TestUnparse(t *testing.T) {
 				env "key" "value"
 			}
 			`,
-		},
-		{
-			"comments preserved",
-			`
+	},
+	{
+		"comments preserved",
+		`
 
 			# comment
 
@@ -459,7 +459,7 @@ func TestUnparse(t *testing.T) {
 
 			fs bar() { scratch; }
 			`,
-			`
+		`
 			# comment
 
 			# comment
@@ -476,12 +476,15 @@ func TestUnparse(t *testing.T) {
 
 			fs bar() { scratch; }
 			`,
-		},
-	} {
+	},
+}
+
+func TestUnparse(t *testing.T) {
+	for _, tc := range unparseTestCases {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			file , _, err := Parse(strings.NewReader(cleanup(tc.input)))
+			file, _, err := Parse(strings.NewReader(cleanup(tc.input)))
 			require.NoError(t, err)
 			require.Equal(t, cleanup(tc.expected), file.String())
 		})
@@ -0,0 +1,68 @@
+package hlb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/moby/buildkit/client"
+	"github.com/openllb/hlb/codegen"
+	"github.com/openllb/hlb/report"
+	"github.com/openllb/hlb/solver"
+)
+
+const (
+	// VendorDir is the default directory that remote sources are vendored
+	// to.
+	VendorDir = "hlb_vendor"
+)
+
+// VendorSources downloads the filesystem of git and http sources to
+// vendorDir, so that they can be generated offline with codegen.WithOffline,
+// and returns the number of sources vendored. Images are skipped, because
+// downloading them with the local exporter would flatten their layers and
+// lose their image config.
+func VendorSources(ctx context.Context, cln *client.Client, vendorDir string, sources []codegen.Source, opts ...solver.SolveOption) (int, error) {
+	seen := make(map[string]struct{})
+	for _, source := range sources {
+		if source.Kind == codegen.SourceImage {
+			continue
+		}
+
+		dir := codegen.VendorPath(vendorDir, source.Kind, source.Key)
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+
+		err := vendorSource(ctx, cln, dir, source, opts...)
+		if err != nil {
+			return len(seen) - 1, fmt.Errorf("%s failed to vendor %s %q: %s", report.FormatPos(source.Call.Position()), source.Kind, source.Key, err)
+		}
+	}
+	return len(seen), nil
+}
+
+func vendorSource(ctx context.Context, cln *client.Client, dir string, source codegen.Source, opts ...solver.SolveOption) error {
+	// Vendor to a temporary directory first, so that failing to vendor a
+	// source doesn't leave a partial copy.
+	tmp := fmt.Sprintf("%s.tmp", dir)
+	err := os.RemoveAll(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	opts = append(opts, solver.WithDownload(filepath.Join(tmp, codegen.VendorContentDir)))
+	err = solver.Solve(ctx, cln, source.State, opts...)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}